@@ -2,6 +2,7 @@ package firebase
 
 import (
 	"context"
+	"fmt"
 	"github.com/pkg/errors"
 	"net/http"
 	"sync"
@@ -25,9 +26,17 @@ var authInstances = struct {
 // received from clients, or creating new App instances that are scoped to a
 // particular authentication UID.
 type Auth struct {
-	app    *App
-	ts     oauth2.TokenSource
-	tsLock sync.Mutex
+	app        *App
+	ts         oauth2.TokenSource
+	tsLock     sync.Mutex
+	signer     Signer
+	signerLock sync.Mutex
+
+	// idTokenVerifier and cookieVerifier are created once and shared by all
+	// the calls, so that their public keys are cached across verifications.
+	idTokenVerifier *tokenVerifier
+	cookieVerifier  *tokenVerifier
+	verifierLock    sync.Mutex
 }
 
 // GetAuth gets the Auth instance for the default App.
@@ -59,12 +68,20 @@ func GetAuthWithApp(app *App) (*Auth, error) {
 // Storage, etc.) and should be less than 128 characters.
 // The developer claims are optional, additional claims to be stored in the
 // token.  The claims must be serializable to JSON.
+//
+// Without a private key in the credential, the token is signed through the
+// IAM signBlob API, see Options.ServiceAccountEmail.
 func (a *Auth) CreateCustomToken(uid string, developerClaims *Claims) (string, error) {
-	if err := a.app.options.ensureServiceAccount(); err != nil {
+	return a.CreateCustomTokenWithContext(context.Background(), uid, developerClaims)
+}
+
+// CreateCustomTokenWithContext is the same as CreateCustomToken, with the
+// given context used for remote signing.
+func (a *Auth) CreateCustomTokenWithContext(ctx context.Context, uid string, developerClaims *Claims) (string, error) {
+	if err := a.ensureSigner(); err != nil {
 		return "", err
 	}
-	c := a.app.options.ServiceAccountCredential
-	return createSignedCustomAuthTokenForUser(uid, developerClaims, c.ClientEmail, c.PrivateKey)
+	return createSignedCustomAuthTokenForUser(ctx, uid, developerClaims, a.signer)
 }
 
 // VerifyIDToken parses and verifies a Firebase ID Token.
@@ -78,7 +95,39 @@ func (a *Auth) CreateCustomToken(uid string, developerClaims *Claims) (string, e
 // and it was issued for the project associated with this Auth instance
 // (which by default is extracted from your service account).
 func (a *Auth) VerifyIDToken(tokenString string) (*Token, error) {
-	return a.VerifyIDTokenWithTransport(tokenString, nil)
+	return a.VerifyIDTokenWithContext(context.Background(), tokenString)
+}
+
+// VerifyIDTokenWithContext is the same as VerifyIDToken, with the given
+// context used for fetching the public keys.
+func (a *Auth) VerifyIDTokenWithContext(ctx context.Context, tokenString string) (*Token, error) {
+	return a.verifyIDToken(ctx, tokenString, nil)
+}
+
+// VerifyIDTokenAndCheckRevoked verifies the ID token like VerifyIDToken, and
+// checks that it has not been revoked with RevokeRefreshTokens and that its
+// user is not disabled.  These checks cost a request to the Auth API.  A
+// revoked token is reported with TokenErrIDTokenRevoked, and the token of a
+// disabled user with TokenErrUserDisabled.
+func (a *Auth) VerifyIDTokenAndCheckRevoked(tokenString string) (*Token, error) {
+	return a.VerifyIDTokenAndCheckRevokedWithContext(context.Background(), tokenString)
+}
+
+// VerifyIDTokenAndCheckRevokedWithContext is the same as
+// VerifyIDTokenAndCheckRevoked, with the given context used for the requests.
+func (a *Auth) VerifyIDTokenAndCheckRevokedWithContext(ctx context.Context, tokenString string) (*Token, error) {
+	token, err := a.VerifyIDTokenWithContext(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := a.newRequestHandler()
+	if err := handler.checkTokenRevoked(ctx, a.idTokenVerifier, token); err != nil {
+		return nil, err
+	}
+	return token, nil
 }
 
 // VerifyIDToken parses and verifies a Firebase ID Token.
@@ -86,145 +135,424 @@ func (a *Auth) VerifyIDToken(tokenString string) (*Token, error) {
 // Same as VerifyIDToken but with the possibility to define the Transport to be use by http.Client
 // This have to be use in Google App Engine standard environment with the fetchUrl transport.
 func (a *Auth) VerifyIDTokenWithTransport(tokenString string, transport http.RoundTripper) (*Token, error) {
-	if err := a.app.options.ensureServiceAccount(); err != nil {
+	return a.verifyIDToken(context.Background(), tokenString, transport)
+}
+
+func (a *Auth) verifyIDToken(ctx context.Context, tokenString string, transport http.RoundTripper) (*Token, error) {
+	if err := a.ensureVerifiers(ctx); err != nil {
 		return nil, err
 	}
-	projectID := a.app.options.ServiceAccountCredential.ProjectID
+	if transport != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+	}
+	return a.idTokenVerifier.VerifyToken(ctx, tokenString)
+}
+
+// ensureVerifiers creates the ID token and session cookie verifiers of the
+// Auth instance, configured by the Options.
+func (a *Auth) ensureVerifiers(ctx context.Context) error {
+	a.verifierLock.Lock()
+	defer a.verifierLock.Unlock()
+	if a.idTokenVerifier != nil {
+		return nil
+	}
+	o := a.app.options
+	if o.authEmulatorHost() == "" {
+		if err := o.ensureCredential(); err != nil {
+			return err
+		}
+	}
 
-	verifier, err := newIDTokenVerifier(context.Background(), projectID)
+	idTokenVerifier, err := newIDTokenVerifier(ctx, o.projectID())
 	if err != nil {
-		return nil, err
+		return err
+	}
+	cookieVerifier, err := newSessionCookieVerifier(ctx, o.projectID())
+	if err != nil {
+		return err
+	}
+	if o.HTTPClient != nil || o.IDTokenCertURL != "" || o.SessionCookieCertURL != "" {
+		idTokenVerifier.keySource = newHTTPKeySource(o.idTokenCertURL(), o.httpClient())
+		cookieVerifier.keySource = newHTTPKeySource(o.sessionCookieCertURL(), o.httpClient())
+	}
+	if o.idTokenCertURL() == o.sessionCookieCertURL() {
+		cookieVerifier.keySource = idTokenVerifier.keySource
+	}
+	for _, v := range []*tokenVerifier{idTokenVerifier, cookieVerifier} {
+		if ks, ok := v.keySource.(*httpKeySource); ok {
+			ks.startRefresher()
+		}
+	}
+	idTokenVerifier.emulated = o.authEmulatorHost() != ""
+	cookieVerifier.emulated = idTokenVerifier.emulated
+	a.idTokenVerifier = idTokenVerifier
+	a.cookieVerifier = cookieVerifier
+	return nil
+}
+
+// Close stops the background refresh of the public keys verifying ID tokens and
+// session cookies.  The Auth instance remains usable, fetching the keys when
+// they expire.
+func (a *Auth) Close() error {
+	a.verifierLock.Lock()
+	defer a.verifierLock.Unlock()
+	for _, v := range []*tokenVerifier{a.idTokenVerifier, a.cookieVerifier} {
+		if v == nil {
+			continue
+		}
+		if ks, ok := v.keySource.(*httpKeySource); ok {
+			ks.Close()
+		}
+	}
+	return nil
+}
+
+// newRequestHandler returns a handler for identitytoolkit calls, which must be
+// preceded by ensureTokenSource.
+func (auth *Auth) newRequestHandler() *requestHandler {
+	o := auth.app.options
+	return &requestHandler{
+		ts:       auth.ts,
+		client:   o.httpClient(),
+		endpoint: o.authAPIEndpoint(),
+		retry:    o.retryPolicy(),
+		// The v1 API is scoped to the project.
+		projectEndpoint: fmt.Sprintf("%sprojects/%s/", o.authAPIV1Endpoint(), o.projectID()),
 	}
-	return verifier.VerifyToken(context.Background(), tokenString)
 }
 
 // GetUser looks up the user identified by the provided user id and
 // returns a user record for the given user if that user is found.
 func (auth *Auth) GetUser(uid string) (*UserRecord, error) {
+	return auth.GetUserWithContext(context.Background(), uid)
+}
+
+// GetUserWithContext is the same as GetUser, with the given context used for
+// the request.
+func (auth *Auth) GetUserWithContext(ctx context.Context, uid string) (*UserRecord, error) {
 	if err := auth.ensureTokenSource(); err != nil {
 		return nil, errors.Wrap(err, "Error ensuring token source")
 	}
-	handler := &requestHandler{ts: auth.ts}
-	return handler.getAccountByUID(uid)
+	handler := auth.newRequestHandler()
+	return handler.getAccountByUID(ctx, uid)
 }
 
 // GetUserByEmail looks up the user identified by the provided email and
 // returns a user record for the given user if that user is found.
 func (auth *Auth) GetUserByEmail(email string) (*UserRecord, error) {
+	return auth.GetUserByEmailWithContext(context.Background(), email)
+}
+
+// GetUserByEmailWithContext is the same as GetUserByEmail, with the given
+// context used for the request.
+func (auth *Auth) GetUserByEmailWithContext(ctx context.Context, email string) (*UserRecord, error) {
+	if err := auth.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := auth.newRequestHandler()
+	return handler.getAccountByEmail(ctx, email)
+}
+
+// GetUserByPhoneNumber looks up the user identified by the provided phone
+// number, in E.164 format, and returns a user record for the given user if
+// that user is found.
+func (auth *Auth) GetUserByPhoneNumber(phoneNumber string) (*UserRecord, error) {
+	return auth.GetUserByPhoneNumberWithContext(context.Background(), phoneNumber)
+}
+
+// GetUserByPhoneNumberWithContext is the same as GetUserByPhoneNumber, with
+// the given context used for the request.
+func (auth *Auth) GetUserByPhoneNumberWithContext(ctx context.Context, phoneNumber string) (*UserRecord, error) {
+	if err := auth.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := auth.newRequestHandler()
+	return handler.getAccountByPhoneNumber(ctx, phoneNumber)
+}
+
+// GetUserByProviderUID looks up the user identified by the uid given by an
+// identity provider, e.g. "google.com", and returns a user record for the
+// given user if that user is found.
+func (auth *Auth) GetUserByProviderUID(providerID, rawID string) (*UserRecord, error) {
+	return auth.GetUserByProviderUIDWithContext(context.Background(), providerID, rawID)
+}
+
+// GetUserByProviderUIDWithContext is the same as GetUserByProviderUID, with
+// the given context used for the request.
+func (auth *Auth) GetUserByProviderUIDWithContext(ctx context.Context, providerID, rawID string) (*UserRecord, error) {
+	if err := auth.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := auth.newRequestHandler()
+	return handler.getAccountByProviderUID(ctx, providerID, rawID)
+}
+
+// GetUsers looks up the users matching the given identifiers.  It returns the
+// users found and the identifiers matching no user.
+func (auth *Auth) GetUsers(identifiers []UserIdentifier) (*GetUsersResult, error) {
+	return auth.GetUsersWithContext(context.Background(), identifiers)
+}
+
+// GetUsersWithContext is the same as GetUsers, with the given context used
+// for the requests.
+func (auth *Auth) GetUsersWithContext(ctx context.Context, identifiers []UserIdentifier) (*GetUsersResult, error) {
+	if err := auth.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := auth.newRequestHandler()
+	return handler.getAccounts(ctx, identifiers)
+}
+
+// ListUsers returns a page of at most pageSize users, starting at the page
+// identified by pageToken, or at the first page if pageToken is empty.  A
+// pageSize of zero fetches the maximum of 1000 users.  The NextPageToken of the
+// returned page is empty on the last page.
+func (auth *Auth) ListUsers(pageToken string, pageSize int) (*UserPage, error) {
+	return auth.ListUsersWithContext(context.Background(), pageToken, pageSize)
+}
+
+// ListUsersWithContext is the same as ListUsers, with the given context used
+// for the request.
+func (auth *Auth) ListUsersWithContext(ctx context.Context, pageToken string, pageSize int) (*UserPage, error) {
 	if err := auth.ensureTokenSource(); err != nil {
 		return nil, errors.Wrap(err, "Error ensuring token source")
 	}
-	handler := &requestHandler{ts: auth.ts}
-	return handler.getAccountByEmail(email)
+	handler := auth.newRequestHandler()
+	return handler.downloadAccount(ctx, pageToken, pageSize)
+}
+
+// Users returns an iterator over all the users of the project, with the given
+// context used for the requests.
+func (auth *Auth) Users(ctx context.Context) *UserIterator {
+	return &UserIterator{auth: auth, ctx: ctx}
 }
 
 // CreateUser creates a new user with the properties provided.
-func (auth *Auth) CreateUser(properties UserProperties) (*UserRecord, error) {
+func (auth *Auth) CreateUser(user *UserToCreate) (*UserRecord, error) {
+	return auth.CreateUserWithContext(context.Background(), user)
+}
+
+// CreateUserWithContext is the same as CreateUser, with the given context
+// used for the requests.
+func (auth *Auth) CreateUserWithContext(ctx context.Context, user *UserToCreate) (*UserRecord, error) {
 	if err := auth.ensureTokenSource(); err != nil {
 		return nil, errors.Wrap(err, "Error ensuring token source")
 	}
-	handler := &requestHandler{ts: auth.ts}
-	uid, err := handler.createNewAccount(properties)
+	handler := auth.newRequestHandler()
+	uid, err := handler.createNewAccount(ctx, user)
 	if err != nil {
 		return nil, err
 	}
-	return handler.getAccountByUID(uid)
+	return handler.getAccountByUID(ctx, uid)
 }
 
 // DeleteUser deletes the user identified by the provided user id and returns
 // nil error when the user is found and successfully deleted.
 func (auth *Auth) DeleteUser(uid string) error {
+	return auth.DeleteUserWithContext(context.Background(), uid)
+}
+
+// DeleteUserWithContext is the same as DeleteUser, with the given context
+// used for the request.
+func (auth *Auth) DeleteUserWithContext(ctx context.Context, uid string) error {
 	if err := auth.ensureTokenSource(); err != nil {
 		return errors.Wrap(err, "Error ensuring token source")
 	}
-	handler := &requestHandler{ts: auth.ts}
-	return handler.deleteAccount(uid)
+	handler := auth.newRequestHandler()
+	return handler.deleteAccount(ctx, uid)
+}
+
+// DeleteUsers deletes the users identified by the provided user ids, whether
+// they are disabled or not.  The users are deleted in batches of 1000, and the
+// users that could not be deleted are reported in the result.
+func (auth *Auth) DeleteUsers(uids []string) (*DeleteUsersResult, error) {
+	return auth.DeleteUsersWithContext(context.Background(), uids)
+}
+
+// DeleteUsersWithContext is the same as DeleteUsers, with the given context
+// used for the requests.
+func (auth *Auth) DeleteUsersWithContext(ctx context.Context, uids []string) (*DeleteUsersResult, error) {
+	return auth.DeleteUsersWithOptions(ctx, uids, nil)
+}
+
+// DeleteUsersWithOptions is the same as DeleteUsersWithContext, with the given
+// options.
+func (auth *Auth) DeleteUsersWithOptions(ctx context.Context, uids []string, opts *DeleteUsersOptions) (*DeleteUsersResult, error) {
+	if err := auth.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	// The v1 API is scoped to the project.
+	if auth.app.options.projectID() == "" {
+		return nil, AuthErrProjectIDMissing
+	}
+	if opts == nil {
+		opts = &DeleteUsersOptions{}
+	}
+	handler := auth.newRequestHandler()
+	return handler.deleteAccounts(ctx, uids, !opts.OnlyDisabled)
+}
+
+// ImportUsers imports at most 1000 users, e.g. to migrate them from another
+// authentication system.  The users are validated before any request is sent,
+// and the users rejected by the server are reported in the result.  Users with
+// a password hash require opts.Hash.
+func (auth *Auth) ImportUsers(users []*UserToImport, opts *UserImportOptions) (*UserImportResult, error) {
+	return auth.ImportUsersWithContext(context.Background(), users, opts)
+}
+
+// ImportUsersWithContext is the same as ImportUsers, with the given context
+// used for the request.
+func (auth *Auth) ImportUsersWithContext(ctx context.Context, users []*UserToImport, opts *UserImportOptions) (*UserImportResult, error) {
+	if err := auth.ensureTokenSource(); err != nil {
+		return nil, errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := auth.newRequestHandler()
+	return handler.uploadAccount(ctx, users, opts)
 }
 
 // UpdateUser updates an existing user with the properties provided.
-func (auth *Auth) UpdateUser(uid string, properties UserProperties) (*UserRecord, error) {
+func (auth *Auth) UpdateUser(uid string, user *UserToUpdate) (*UserRecord, error) {
+	return auth.UpdateUserWithContext(context.Background(), uid, user)
+}
+
+// UpdateUserWithContext is the same as UpdateUser, with the given context
+// used for the requests.
+func (auth *Auth) UpdateUserWithContext(ctx context.Context, uid string, user *UserToUpdate) (*UserRecord, error) {
 	if err := auth.ensureTokenSource(); err != nil {
 		return nil, errors.Wrap(err, "Error ensuring token source")
 	}
-	handler := &requestHandler{ts: auth.ts}
-	uid, err := handler.updateExistingAccount(uid, properties)
+	handler := auth.newRequestHandler()
+	uid, err := handler.updateExistingAccount(ctx, uid, user)
 	if err != nil {
 		return nil, err
 	}
-	return handler.getAccountByUID(uid)
+	return handler.getAccountByUID(ctx, uid)
+}
+
+// SetCustomUserClaims sets the custom claims of an existing user, replacing
+// the previous ones.  The claims are propagated to the user's ID tokens when
+// they are next refreshed.  They must not use reserved names such as "sub" or
+// "exp", and must be at most 1000 bytes once serialized to JSON.  Nil claims
+// remove the custom claims of the user.
+func (auth *Auth) SetCustomUserClaims(uid string, claims map[string]interface{}) error {
+	return auth.SetCustomUserClaimsWithContext(context.Background(), uid, claims)
+}
+
+// SetCustomUserClaimsWithContext is the same as SetCustomUserClaims, with the
+// given context used for the request.
+func (auth *Auth) SetCustomUserClaimsWithContext(ctx context.Context, uid string, claims map[string]interface{}) error {
+	if err := auth.ensureTokenSource(); err != nil {
+		return errors.Wrap(err, "Error ensuring token source")
+	}
+	handler := auth.newRequestHandler()
+	return handler.setCustomUserClaims(ctx, uid, claims)
 }
 
-// CreateSessionCookie attempts to create a session cookie for the given user id
+// CreateSessionCookie exchanges the given ID token for a session cookie,
+// valid for the given duration between 5 minutes and 2 weeks, or 5 days if
+// nil.  The session cookie is verified with VerifySessionCookie.
 func (auth *Auth) CreateSessionCookie(idToken string, duration *time.Duration) (*string, error) {
+	return auth.CreateSessionCookieWithContext(context.Background(), idToken, duration)
+}
+
+// CreateSessionCookieWithContext is the same as CreateSessionCookie, with the
+// given context used for the requests.
+func (auth *Auth) CreateSessionCookieWithContext(ctx context.Context, idToken string, duration *time.Duration) (*string, error) {
+	expiry := defaultSessionCookieDuration
+	if duration != nil {
+		expiry = *duration
+	}
+	if err := validateSessionCookieParams(idToken, expiry); err != nil {
+		return nil, err
+	}
 	if err := auth.ensureTokenSource(); err != nil {
 		return nil, errors.Wrap(err, "Error ensuring token source")
 	}
-	handler := &requestHandler{ts: auth.ts}
+	handler := auth.newRequestHandler()
 
-	_, err := auth.VerifyIDToken(idToken)
+	_, err := auth.VerifyIDTokenWithContext(ctx, idToken)
 	if err != nil {
 		return nil, err
 	}
 
-	expiry := int64((time.Hour * 24 * 5).Seconds())
-
-	if duration != nil {
-		expiry = int64(duration.Seconds())
-	}
+	return handler.createSessionCookie(ctx, idToken, expiry)
+}
 
-	return handler.createSessionCookie(idToken, expiry)
+// VerifySessionCookieAndCheckRevoked verifies the session cookie like
+// VerifySessionCookie, and checks that it has not been revoked with
+// RevokeRefreshTokens and that its user is not disabled.  A revoked cookie is
+// reported with TokenErrSessionCookieRevoked, and the cookie of a disabled user
+// with TokenErrUserDisabled.
+func (auth *Auth) VerifySessionCookieAndCheckRevoked(cookie string) (*Token, error) {
+	return auth.VerifySessionCookieAndCheckRevokedWithContext(context.Background(), cookie)
 }
 
-// VerifySessionCookieAndCheckRevoked checks if the cookie is valid and has not been revoked
-func (auth *Auth) VerifySessionCookieAndCheckRevoked(cookie string) (*UserRecord, error) {
+// VerifySessionCookieAndCheckRevokedWithContext is the same as
+// VerifySessionCookieAndCheckRevoked, with the given context used for the
+// requests.
+func (auth *Auth) VerifySessionCookieAndCheckRevokedWithContext(ctx context.Context, cookie string) (*Token, error) {
 	if err := auth.ensureTokenSource(); err != nil {
 		return nil, errors.Wrap(err, "Error ensuring token source")
 	}
-	projectID := auth.app.options.ServiceAccountCredential.ProjectID
+	if err := auth.ensureVerifiers(ctx); err != nil {
+		return nil, err
+	}
 
-	handler := &requestHandler{ts: auth.ts}
+	handler := auth.newRequestHandler()
 
-	return handler.verifySessionCookieAndCheckRevoked(projectID, cookie)
+	return handler.verifySessionCookieAndCheckRevoked(ctx, auth.cookieVerifier, cookie)
 }
 
-// CheckRevoked checks if the cookie has not been revoked
+// CheckRevoked verifies the session cookie and tells whether it is still
+// valid, i.e. it has not been revoked with RevokeRefreshTokens and its user is
+// not disabled.
 func (auth *Auth) CheckRevoked(cookie string) (bool, error) {
+	return auth.CheckRevokedWithContext(context.Background(), cookie)
+}
+
+// CheckRevokedWithContext is the same as CheckRevoked, with the given context
+// used for the requests.
+func (auth *Auth) CheckRevokedWithContext(ctx context.Context, cookie string) (bool, error) {
 	if err := auth.ensureTokenSource(); err != nil {
 		return false, errors.Wrap(err, "Error ensuring token source")
 	}
-	projectID := auth.app.options.ServiceAccountCredential.ProjectID
+	if err := auth.ensureVerifiers(ctx); err != nil {
+		return false, err
+	}
 
-	handler := &requestHandler{ts: auth.ts}
+	handler := auth.newRequestHandler()
 
-	return handler.checkSessionCookieRevoked(projectID, cookie)
+	return handler.checkSessionCookieRevoked(ctx, auth.cookieVerifier, cookie)
 }
 
-// VerifySessionCookie checks if the cookie is valid
-func (auth *Auth) VerifySessionCookie(cookie string) (*UserRecord, error) {
-	if err := auth.ensureTokenSource(); err != nil {
-		return nil, errors.Wrap(err, "Error ensuring token source")
-	}
-	projectID := auth.app.options.ServiceAccountCredential.ProjectID
-
-	handler := &requestHandler{ts: auth.ts}
+// VerifySessionCookie verifies the signature and the claims of a session
+// cookie created with CreateSessionCookie, and returns its decoded token.
+func (auth *Auth) VerifySessionCookie(cookie string) (*Token, error) {
+	return auth.VerifySessionCookieWithContext(context.Background(), cookie)
+}
 
-	token, err := handler.verifySessionCookie(projectID, cookie)
-	if err != nil {
+// VerifySessionCookieWithContext is the same as VerifySessionCookie, with the
+// given context used for fetching the public keys.
+func (auth *Auth) VerifySessionCookieWithContext(ctx context.Context, cookie string) (*Token, error) {
+	if err := auth.ensureVerifiers(ctx); err != nil {
 		return nil, err
 	}
 
-	uid := token.UID
-
-	return auth.GetUser(uid)
+	return auth.cookieVerifier.VerifyToken(ctx, cookie)
 }
 
 // RevokeRefreshTokens revokes all session cookie refresh tokens for the user
 func (auth *Auth) RevokeRefreshTokens(uid string) error {
+	return auth.RevokeRefreshTokensWithContext(context.Background(), uid)
+}
+
+// RevokeRefreshTokensWithContext is the same as RevokeRefreshTokens, with the
+// given context used for the requests.
+func (auth *Auth) RevokeRefreshTokensWithContext(ctx context.Context, uid string) error {
 	if err := auth.ensureTokenSource(); err != nil {
 		return errors.Wrap(err, "Error ensuring token source")
 	}
-	// handler := &requestHandler{ts: auth.ts}
-	user, err := auth.GetUser(uid)
+	user, err := auth.GetUserWithContext(ctx, uid)
 
 	if err != nil {
 		return err
@@ -234,10 +562,6 @@ func (auth *Auth) RevokeRefreshTokens(uid string) error {
 		return errors.New("User id match failed")
 	}
 
-	properties := UserProperties{}
-
-	properties.SetValidSince(time.Now())
-
-	_, err = auth.UpdateUser(uid, properties)
+	_, err = auth.UpdateUserWithContext(ctx, uid, (&UserToUpdate{}).validSince(time.Now()))
 	return err
 }
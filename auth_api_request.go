@@ -8,8 +8,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"reflect"
 	"regexp"
+	"sort"
 	"time"
 
 	"golang.org/x/net/context"
@@ -19,7 +19,9 @@ import (
 
 const (
 	authAPIEndpoint = "https://www.googleapis.com/identitytoolkit/v3/relyingparty/"
-	authAPITimeout  = time.Second * 10
+	// authAPIV1Endpoint is the base URL of the v1 identitytoolkit API.
+	authAPIV1Endpoint = "https://identitytoolkit.googleapis.com/v1/"
+	authAPITimeout    = time.Second * 10
 )
 
 var (
@@ -33,6 +35,12 @@ type apiSettings struct {
 	endpoint string
 	reqFn    validateFunc
 	respFn   validateFunc
+	// projectScoped tells whether endpoint is relative to the project
+	// resource of the v1 API, rather than to the v3 relyingparty API.
+	projectScoped bool
+	// idempotent tells whether the request can safely be sent again after a
+	// connection error or a 5xx response.  Nil means always.
+	idempotent func(src interface{}) bool
 }
 
 var (
@@ -46,8 +54,10 @@ var (
 		reqFn: func(src interface{}) error {
 			if r, ok := src.(*getAccountInfoRequest); !ok {
 				return errIllegalType
-			} else if s1, s2 := len(r.LocalID), len(r.Email); s1 == 0 && s2 == 0 {
+			} else if r.count() == 0 {
 				return errMissingRequestTarget
+			} else if r.count() > maxGetAccountInfoIdentifiers {
+				return errTooManyIdentifiers
 			}
 			return nil
 		},
@@ -80,13 +90,16 @@ var (
 			} else if _, ok := r["localId"]; !ok {
 				return errMissingRequestTarget
 			}
-			return validateCreateEditRequest(r)
+			return nil
 		},
 		respFn: func(src interface{}) error {
 			if r, ok := src.(*createEditAccountResponse); !ok {
 				return errIllegalType
 			} else if r.LocalID == "" {
-				return AuthErrUserNotFound
+				return &APIError{
+					Code:    AuthErrUserNotFound.Code,
+					Message: AuthErrUserNotFound.Message,
+				}
 			}
 			return nil
 		},
@@ -95,11 +108,17 @@ var (
 		method:   "POST",
 		endpoint: "signupNewUser",
 		reqFn: func(src interface{}) error {
-			r, ok := src.(map[string]interface{})
-			if !ok {
+			if _, ok := src.(map[string]interface{}); !ok {
 				return errIllegalType
 			}
-			return validateCreateEditRequest(r)
+			return nil
+		},
+		// Sending the request again may create a second user, unless the
+		// uid is given: the retry then fails with auth/uid-already-exists.
+		idempotent: func(src interface{}) bool {
+			r, _ := src.(map[string]interface{})
+			_, ok := r["localId"]
+			return ok
 		},
 		respFn: func(src interface{}) error {
 			if r, ok := src.(*createEditAccountResponse); !ok {
@@ -115,27 +134,112 @@ var (
 	}
 )
 
+const (
+	// maxListUsersResults is the maximum number of users downloaded per
+	// downloadAccount request.
+	maxListUsersResults = 1000
+	// maxDeleteAccounts is the maximum number of users deleted per
+	// batchDelete request.
+	maxDeleteAccounts = 1000
+	// maxGetAccountInfoIdentifiers is the maximum number of identifiers per
+	// getAccountInfo request.
+	maxGetAccountInfoIdentifiers = 100
+)
+
+var (
+	errTooManyIdentifiers = &APIError{
+		Code:    AuthErrInvalidArgument.Code,
+		Message: fmt.Sprintf("At most %d identifiers can be looked up at once.", maxGetAccountInfoIdentifiers),
+	}
+	batchDeleteAccountsAPI = &apiSettings{
+		method:        "POST",
+		endpoint:      "accounts:batchDelete",
+		projectScoped: true,
+		reqFn: func(src interface{}) error {
+			if r, ok := src.(*batchDeleteAccountsRequest); !ok {
+				return errIllegalType
+			} else if len(r.LocalIDs) == 0 {
+				return errMissingRequestTarget
+			}
+			return nil
+		},
+		respFn: func(src interface{}) error {
+			if _, ok := src.(*batchDeleteAccountsResponse); !ok {
+				return errIllegalType
+			}
+			return nil
+		},
+	}
+	errInvalidPageSize = &APIError{
+		Code:    AuthErrInvalidArgument.Code,
+		Message: fmt.Sprintf("Page size must be between 1 and %d.", maxListUsersResults),
+	}
+	downloadAccountAPI = &apiSettings{
+		method:   "POST",
+		endpoint: "downloadAccount",
+		reqFn: func(src interface{}) error {
+			if r, ok := src.(*downloadAccountRequest); !ok {
+				return errIllegalType
+			} else if r.MaxResults < 1 || r.MaxResults > maxListUsersResults {
+				return errInvalidPageSize
+			}
+			return nil
+		},
+		respFn: func(src interface{}) error {
+			if _, ok := src.(*downloadAccountResponse); !ok {
+				return errIllegalType
+			}
+			return nil
+		},
+	}
+)
+
 type getAccountInfoRequest struct {
-	LocalID string `json:"localId,omitempty"`
-	Email   string `json:"email,omitempty"`
+	LocalID         []string                   `json:"localId,omitempty"`
+	Email           []string                   `json:"email,omitempty"`
+	PhoneNumber     []string                   `json:"phoneNumber,omitempty"`
+	FederatedUserID []*federatedUserIdentifier `json:"federatedUserId,omitempty"`
+}
+
+type federatedUserIdentifier struct {
+	ProviderID string `json:"providerId"`
+	RawID      string `json:"rawId"`
+}
+
+// count returns the number of identifiers of the request.
+func (r *getAccountInfoRequest) count() int {
+	return len(r.LocalID) + len(r.Email) + len(r.PhoneNumber) + len(r.FederatedUserID)
 }
 
 type getAccountInfoResponse struct {
-	Users *accountInfo `json:"users"`
+	Users []*accountInfo `json:"users"`
 }
 
 type accountInfo struct {
-	LocalID          string          `json:"localId"`
-	Email            string          `json:"email"`
-	PhoneNumber      string          `json:"phoneNumber"`
-	EmailVerified    bool            `json:"emailVerified"`
-	DisplayName      string          `json:"displayName"`
-	PhotoURL         string          `json:"photoUrl"`
-	Disabled         bool            `json:"disabled"`
-	ValidSince       int64           `json:"validSince,string"`
-	LastLoginAt      int64           `json:"lastLoginAt,string"`
-	CreatedAt        int64           `json:"createdAt,string"`
-	ProviderUserInfo []*providerInfo `json:"providerUserInfo"`
+	LocalID          string           `json:"localId"`
+	Email            string           `json:"email"`
+	PhoneNumber      string           `json:"phoneNumber"`
+	EmailVerified    bool             `json:"emailVerified"`
+	DisplayName      string           `json:"displayName"`
+	PhotoURL         string           `json:"photoUrl"`
+	Disabled         bool             `json:"disabled"`
+	ValidSince       int64            `json:"validSince,string"`
+	LastLoginAt      int64            `json:"lastLoginAt,string"`
+	CreatedAt        int64            `json:"createdAt,string"`
+	LastRefreshAt    string           `json:"lastRefreshAt"`
+	CustomAttributes string           `json:"customAttributes"`
+	PasswordHash     string           `json:"passwordHash"`
+	Salt             string           `json:"salt"`
+	TenantID         string           `json:"tenantId"`
+	MFAInfo          []*mfaEnrollment `json:"mfaInfo"`
+	ProviderUserInfo []*providerInfo  `json:"providerUserInfo"`
+}
+
+type mfaEnrollment struct {
+	MFAEnrollmentID string `json:"mfaEnrollmentId"`
+	DisplayName     string `json:"displayName"`
+	PhoneInfo       string `json:"phoneInfo"`
+	EnrolledAt      string `json:"enrolledAt"`
 }
 
 type providerInfo struct {
@@ -144,35 +248,113 @@ type providerInfo struct {
 	ProviderID  string `json:"providerId"`
 	DisplayName string `json:"displayName"`
 	Email       string `json:"email"`
+	PhoneNumber string `json:"phoneNumber"`
 	PhotoURL    string `json:"photoUrl"`
 }
 
-func (h *requestHandler) getAccountByUID(uid string) (*UserRecord, error) {
+func (h *requestHandler) getAccountByUID(ctx context.Context, uid string) (*UserRecord, error) {
 	if !isValidUID(uid) {
 		return nil, AuthErrInvalidUID
 	}
 	req := &getAccountInfoRequest{
-		LocalID: uid,
-	}
-	resp := new(getAccountInfoResponse)
-	if err := h.call(getAccountInfoAPI, req, resp); err != nil {
-		return nil, err
+		LocalID: []string{uid},
 	}
-	return newUserRecord(resp.Users)
+	return h.getAccount(ctx, req)
 }
 
-func (h *requestHandler) getAccountByEmail(email string) (*UserRecord, error) {
+func (h *requestHandler) getAccountByEmail(ctx context.Context, email string) (*UserRecord, error) {
 	if !isValidEmail(email) {
 		return nil, AuthErrInvalidEmail
 	}
 	req := &getAccountInfoRequest{
-		Email: email,
+		Email: []string{email},
+	}
+	return h.getAccount(ctx, req)
+}
+
+func (h *requestHandler) getAccountByPhoneNumber(ctx context.Context, phoneNumber string) (*UserRecord, error) {
+	id := PhoneIdentifier{PhoneNumber: phoneNumber}
+	if err := id.validate(); err != nil {
+		return nil, err
+	}
+	req := new(getAccountInfoRequest)
+	id.populate(req)
+	return h.getAccount(ctx, req)
+}
+
+func (h *requestHandler) getAccountByProviderUID(ctx context.Context, providerID, rawID string) (*UserRecord, error) {
+	id := ProviderIdentifier{ProviderID: providerID, ProviderUID: rawID}
+	if err := id.validate(); err != nil {
+		return nil, err
 	}
+	req := new(getAccountInfoRequest)
+	id.populate(req)
+	return h.getAccount(ctx, req)
+}
+
+// getAccount returns the single user matching req.
+func (h *requestHandler) getAccount(ctx context.Context, req *getAccountInfoRequest) (*UserRecord, error) {
 	resp := new(getAccountInfoResponse)
-	if err := h.call(getAccountInfoAPI, req, resp); err != nil {
+	if err := h.call(ctx, getAccountInfoAPI, req, resp); err != nil {
 		return nil, err
 	}
-	return newUserRecord(resp.Users)
+	if len(resp.Users) == 0 {
+		return nil, &APIError{
+			Code:    AuthErrUserNotFound.Code,
+			Message: AuthErrUserNotFound.Message,
+		}
+	}
+	return newUserRecord(resp.Users[0])
+}
+
+// getAccounts looks up the users matching the given identifiers, in requests
+// of at most maxGetAccountInfoIdentifiers identifiers.
+func (h *requestHandler) getAccounts(ctx context.Context, identifiers []UserIdentifier) (*GetUsersResult, error) {
+	for _, id := range identifiers {
+		if err := id.validate(); err != nil {
+			return nil, err
+		}
+	}
+	result := &GetUsersResult{}
+	seen := make(map[string]bool)
+	for start := 0; start < len(identifiers); start += maxGetAccountInfoIdentifiers {
+		end := start + maxGetAccountInfoIdentifiers
+		if end > len(identifiers) {
+			end = len(identifiers)
+		}
+		req := new(getAccountInfoRequest)
+		for _, id := range identifiers[start:end] {
+			id.populate(req)
+		}
+		resp := new(getAccountInfoResponse)
+		if err := h.call(ctx, getAccountInfoAPI, req, resp); err != nil {
+			return nil, err
+		}
+		for _, info := range resp.Users {
+			user, err := newUserRecord(info)
+			if err != nil {
+				return nil, err
+			}
+			// A user matching several identifiers is returned once.
+			if !seen[user.UID] {
+				seen[user.UID] = true
+				result.Users = append(result.Users, user)
+			}
+		}
+	}
+	for _, id := range identifiers {
+		found := false
+		for _, user := range result.Users {
+			if id.matches(user) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+	return result, nil
 }
 
 func newUserRecord(info *accountInfo) (*UserRecord, error) {
@@ -190,17 +372,47 @@ func newUserRecord(info *accountInfo) (*UserRecord, error) {
 		DisplayName:   info.DisplayName,
 		PhotoURL:      info.PhotoURL,
 		Disabled:      info.Disabled,
+		PasswordHash:  info.PasswordHash,
+		PasswordSalt:  info.Salt,
+		TenantID:      info.TenantID,
+
+		TokensValidAfterMillis: info.ValidSince * 1000,
+	}
+	if info.CustomAttributes != "" {
+		if err := json.Unmarshal([]byte(info.CustomAttributes), &user.CustomClaims); err != nil {
+			return nil, &APIError{
+				Code:    AuthErrInternalError.Code,
+				Message: "INTERNAL ASSERT FAILED: Invalid custom claims in user response",
+				Err:     err,
+			}
+		}
 	}
 	user.Metadata = &UserMetadata{
-		CreatedAt:    parseDate(info.CreatedAt),
-		LastSignedIn: parseDate(info.LastLoginAt),
+		CreatedAt:       parseDate(info.CreatedAt),
+		LastSignedIn:    parseDate(info.LastLoginAt),
+		LastRefreshTime: parseTimestamp(info.LastRefreshAt),
+	}
+	if len(info.MFAInfo) > 0 {
+		user.MultiFactor = &MultiFactorSettings{}
+		for _, val := range info.MFAInfo {
+			factor := &MultiFactorInfo{
+				UID:            val.MFAEnrollmentID,
+				DisplayName:    val.DisplayName,
+				EnrollmentTime: parseTimestamp(val.EnrolledAt),
+			}
+			if val.PhoneInfo != "" {
+				factor.FactorID = phoneMultiFactorID
+				factor.PhoneNumber = val.PhoneInfo
+			}
+			user.MultiFactor.EnrolledFactors = append(user.MultiFactor.EnrolledFactors, factor)
+		}
 	}
 	user.ProviderData = make([]*UserInfo, len(info.ProviderUserInfo))
 	for idx, val := range info.ProviderUserInfo {
 		user.ProviderData[idx] = &UserInfo{
 			UID:         val.RawID,
 			DisplayName: val.DisplayName,
-			PhoneNumber: info.PhoneNumber,
+			PhoneNumber: val.PhoneNumber,
 			Email:       val.Email,
 			PhotoURL:    val.PhotoURL,
 			ProviderID:  val.ProviderID,
@@ -209,37 +421,139 @@ func newUserRecord(info *accountInfo) (*UserRecord, error) {
 	return user, nil
 }
 
+// parseDate returns the UTC time of the given milliseconds since epoch, or the
+// zero time if millis is zero.
 func parseDate(millis int64) time.Time {
+	if millis == 0 {
+		return time.Time{}
+	}
 	nano := millis * int64(time.Millisecond)
-	return time.Unix(0, nano)
+	return time.Unix(0, nano).UTC()
+}
+
+// parseTimestamp returns the UTC time of the given RFC 3339 timestamp, or the
+// zero time if it is empty or invalid.
+func parseTimestamp(timestamp string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+type downloadAccountRequest struct {
+	MaxResults    int    `json:"maxResults"`
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
+type downloadAccountResponse struct {
+	Users         []*accountInfo `json:"users"`
+	NextPageToken string         `json:"nextPageToken"`
+}
+
+func (h *requestHandler) downloadAccount(ctx context.Context, pageToken string, pageSize int) (*UserPage, error) {
+	if pageSize == 0 {
+		pageSize = maxListUsersResults
+	}
+	req := &downloadAccountRequest{
+		MaxResults:    pageSize,
+		NextPageToken: pageToken,
+	}
+	resp := new(downloadAccountResponse)
+	if err := h.call(ctx, downloadAccountAPI, req, resp); err != nil {
+		return nil, err
+	}
+	page := &UserPage{
+		Users:         make([]*UserRecord, 0, len(resp.Users)),
+		NextPageToken: resp.NextPageToken,
+	}
+	for _, info := range resp.Users {
+		user, err := newUserRecord(info)
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	return page, nil
 }
 
 type deleteAccountRequest struct {
 	LocalID string `json:"localId,omitempty"`
 }
 
-func (h *requestHandler) deleteAccount(uid string) error {
+func (h *requestHandler) deleteAccount(ctx context.Context, uid string) error {
 	if !isValidUID(uid) {
 		return AuthErrInvalidUID
 	}
 	req := &deleteAccountRequest{
 		LocalID: uid,
 	}
-	if err := h.call(deleteAccountAPI, req, &struct{}{}); err != nil {
+	if err := h.call(ctx, deleteAccountAPI, req, &struct{}{}); err != nil {
 		return err
 	}
 	return nil
 }
 
+type batchDeleteAccountsRequest struct {
+	LocalIDs []string `json:"localIds"`
+	Force    bool     `json:"force,omitempty"`
+}
+
+type batchDeleteAccountsResponse struct {
+	Errors []*batchDeleteErrorInfo `json:"errors"`
+}
+
+type batchDeleteErrorInfo struct {
+	Index   int    `json:"index"`
+	LocalID string `json:"localId"`
+	Message string `json:"message"`
+}
+
+// deleteAccounts deletes the users with the given uids, in requests of at most
+// maxDeleteAccounts users.
+func (h *requestHandler) deleteAccounts(ctx context.Context, uids []string, force bool) (*DeleteUsersResult, error) {
+	for _, uid := range uids {
+		if !isValidUID(uid) {
+			return nil, AuthErrInvalidUID
+		}
+	}
+	result := &DeleteUsersResult{}
+	for start := 0; start < len(uids); start += maxDeleteAccounts {
+		end := start + maxDeleteAccounts
+		if end > len(uids) {
+			end = len(uids)
+		}
+		req := &batchDeleteAccountsRequest{
+			LocalIDs: uids[start:end],
+			Force:    force,
+		}
+		resp := new(batchDeleteAccountsResponse)
+		if err := h.call(ctx, batchDeleteAccountsAPI, req, resp); err != nil {
+			return nil, err
+		}
+		for _, e := range resp.Errors {
+			result.Errors = append(result.Errors, &DeleteUsersErrorInfo{
+				Index:  start + e.Index,
+				UID:    e.LocalID,
+				Reason: e.Message,
+			})
+		}
+		result.SuccessCount += end - start - len(resp.Errors)
+		result.FailureCount += len(resp.Errors)
+	}
+	return result, nil
+}
+
 var (
 	errNullUserProperty = &APIError{
 		Code:    AuthErrInvalidArgument.Code,
 		Message: "Properties argument must be a non-nil instance.",
 	}
+	// deletableParams are the attributes removed by setAccountInfo's
+	// deleteAttribute when set to an empty string.
 	deletableParams = map[string]string{
 		"displayName": "DISPLAY_NAME",
-		"photoURL":    "PHOTO_URL",
-		"phoneNumber": "PHONE_NUMBER",
+		"photoUrl":    "PHOTO_URL",
 	}
 )
 
@@ -247,67 +561,118 @@ type createEditAccountResponse struct {
 	LocalID string `json:"localId"`
 }
 
-func (h *requestHandler) updateExistingAccount(uid string, properties UserProperties) (string, error) {
+func (h *requestHandler) updateExistingAccount(ctx context.Context, uid string, user *UserToUpdate) (string, error) {
 	if !isValidUID(uid) {
 		return "", AuthErrInvalidUID
-	} else if properties == nil {
+	} else if user == nil {
 		return "", errNullUserProperty
 	}
-	req := make(map[string]interface{})
-	for key, val := range properties {
-		req[key] = val
+	req, err := user.request()
+	if err != nil {
+		return "", err
 	}
 	req["localId"] = uid
-	deleting := make([]string, 0, len(deletableParams))
-	for key, param := range deletableParams {
-		if val, ok := req[key]; ok && isEmptyValue(val) {
+	resp := new(createEditAccountResponse)
+	if err := h.call(ctx, setAccountAPI, req, resp); err != nil {
+		return "", err
+	}
+	return resp.LocalID, nil
+}
+
+func (h *requestHandler) setCustomUserClaims(ctx context.Context, uid string, claims map[string]interface{}) error {
+	_, err := h.updateExistingAccount(ctx, uid, (&UserToUpdate{}).CustomClaims(claims))
+	return err
+}
+
+func (h *requestHandler) createNewAccount(ctx context.Context, user *UserToCreate) (string, error) {
+	if user == nil {
+		return "", errNullUserProperty
+	}
+	req, err := user.request()
+	if err != nil {
+		return "", err
+	}
+	resp := new(createEditAccountResponse)
+	if err := h.call(ctx, signUpNewUserAPI, req, resp); err != nil {
+		return "", err
+	}
+	return resp.LocalID, nil
+}
+
+// request validates the user to create and returns the signupNewUser request.
+func (u *UserToCreate) request() (map[string]interface{}, error) {
+	req := make(map[string]interface{}, len(u.params))
+	for key, val := range u.params {
+		req[key] = val
+	}
+	if err := validateUserParams(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// request validates the user to update and returns the setAccountInfo
+// request, without its localId.
+func (u *UserToUpdate) request() (map[string]interface{}, error) {
+	req := make(map[string]interface{}, len(u.params))
+	var deleting []string
+	for key, val := range u.params {
+		if param, ok := deletableParams[key]; ok && val == "" {
 			deleting = append(deleting, param)
-			delete(req, key)
+			continue
 		}
+		req[key] = val
 	}
 	if len(deleting) > 0 {
+		sort.Strings(deleting)
 		req["deleteAttribute"] = deleting
 	}
-	if val, ok := req["photoURL"]; ok {
-		req["photoUrl"] = val
-		delete(req, "photoURL")
+	if val, ok := req["phoneNumber"]; ok && val == "" {
+		req["deleteProvider"] = []string{"phone"}
+		delete(req, "phoneNumber")
 	}
-	if val, ok := req["disabled"]; ok {
-		req["disableUser"] = val
-		delete(req, "disabled")
+	if err := validateUserParams(req); err != nil {
+		return nil, err
 	}
-	resp := new(createEditAccountResponse)
-	if err := h.call(setAccountAPI, req, resp); err != nil {
-		return "", err
+	if val, ok := req["customAttributes"]; ok {
+		claims, err := marshalCustomClaims(val.(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		req["customAttributes"] = claims
 	}
-	return resp.LocalID, nil
+	return req, nil
 }
 
-func (h *requestHandler) createNewAccount(properties UserProperties) (string, error) {
-	if properties == nil {
-		return "", errNullUserProperty
+// validateUserParams validates the properties of a user to create or update.
+func validateUserParams(params map[string]interface{}) error {
+	if uid, ok := params["localId"].(string); ok && !isValidUID(uid) {
+		return AuthErrInvalidUID
 	}
-	req := make(map[string]interface{})
-	for key, val := range properties {
-		req[key] = val
+	if name, ok := params["displayName"].(string); ok && name == "" {
+		return AuthErrInvalidDisplayName
 	}
-	if val, ok := req["photoURL"]; ok {
-		req["photoUrl"] = val
-		delete(req, "photoURL")
+	if email, ok := params["email"].(string); ok && !isValidEmail(email) {
+		return AuthErrInvalidEmail
 	}
-	if val, ok := req["uid"]; ok {
-		req["localId"] = val
-		delete(req, "uid")
+	if password, ok := params["password"].(string); ok && !isValidPassword(password) {
+		return AuthErrInvalidPassword
 	}
-	resp := new(createEditAccountResponse)
-	if err := h.call(signUpNewUserAPI, req, resp); err != nil {
-		return "", err
+	if photoURL, ok := params["photoUrl"].(string); ok && !isValidURL(photoURL) {
+		return AuthErrInvalidPhotoURL
 	}
-	return resp.LocalID, nil
+	if phoneNumber, ok := params["phoneNumber"].(string); ok && !isValidPhoneNumber(phoneNumber) {
+		return AuthErrInvalidPhoneNumber
+	}
+	return nil
 }
 
 type requestHandler struct {
-	ts oauth2.TokenSource
+	ts              oauth2.TokenSource
+	client          *http.Client
+	endpoint        string
+	projectEndpoint string
+	retry           *RetryPolicy
 }
 
 func (h *requestHandler) getToken() (string, error) {
@@ -318,12 +683,12 @@ func (h *requestHandler) getToken() (string, error) {
 	return t.AccessToken, nil
 }
 
-func buildHTTPRequest(api *apiSettings, src interface{}, tokenFunc func() (string, error)) (*http.Request, error) {
+func buildHTTPRequest(baseURL string, api *apiSettings, src interface{}, tokenFunc func() (string, error)) (*http.Request, error) {
 	srcBytes, err := json.Marshal(src)
 	if err != nil {
 		return nil, err
 	}
-	endpoint := authAPIEndpoint + api.endpoint
+	endpoint := baseURL + api.endpoint
 	req, err := http.NewRequest(api.method, endpoint, bytes.NewBuffer(srcBytes))
 	if err != nil {
 		return nil, err
@@ -351,7 +716,13 @@ func getErrorResponse(resp *http.Response) error {
 	}
 	res := new(apiErrorResponse)
 	if err := json.Unmarshal(bodyBytes, res); err != nil {
-		return fmt.Errorf("unmarshal error response failed: %v", err)
+		return &APIError{
+			Code:    AuthErrInternalError.Code,
+			Message: fmt.Sprintf("Unexpected response with status %d: %s", resp.StatusCode, string(bodyBytes)),
+			Status:  resp.StatusCode,
+			Raw:     bodyBytes,
+			Err:     err,
+		}
 	}
 	var errorCode string
 	if res.RawServerError == nil {
@@ -361,7 +732,7 @@ func getErrorResponse(resp *http.Response) error {
 	} else if errorCode, ok = message.(string); !ok {
 		errorCode = ""
 	}
-	return authFromServerError(errorCode, res)
+	return authFromServerError(resp.StatusCode, errorCode, bodyBytes)
 }
 
 func loadHTTPResponse(resp *http.Response, dst interface{}) error {
@@ -373,33 +744,74 @@ func loadHTTPResponse(resp *http.Response, dst interface{}) error {
 	return nil
 }
 
-func (h *requestHandler) call(api *apiSettings, src, dst interface{}) error {
+// call sends the request to the given API and decodes the response into dst.
+// Failed attempts are retried according to the retry policy of the handler.
+// Each attempt is bound to ctx, and to authAPITimeout if ctx has no deadline.
+func (h *requestHandler) call(ctx context.Context, api *apiSettings, src, dst interface{}) error {
 	if api.reqFn != nil {
 		if err := api.reqFn(src); err != nil {
 			return err
 		}
 	}
-	req, err := buildHTTPRequest(api, src, h.getToken)
-	if err != nil {
-		return err
+	policy := h.retry
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+	baseURL := h.endpoint
+	if api.projectScoped {
+		baseURL = h.projectEndpoint
+	}
+	for retry := 1; ; retry++ {
+		req, err := buildHTTPRequest(baseURL, api, src, h.getToken)
+		if err != nil {
+			return err
+		}
+		status, wait, err := h.attempt(ctx, req, api, dst)
+		if err == nil {
+			return nil
+		}
+		if retry > policy.MaxRetries || ctx.Err() != nil || !isRetryableStatus(status) {
+			return err
+		}
+		// Requests rejected with 429 were not processed, so they can be sent
+		// again even when they are not idempotent.
+		if api.idempotent != nil && !api.idempotent(src) && status != http.StatusTooManyRequests {
+			return err
+		}
+		if wait > policy.MaxBackoff {
+			return err
+		} else if wait == 0 {
+			wait = policy.backoff(retry)
+		}
+		if retrySleep(ctx, wait) != nil {
+			return err
+		}
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.TODO(), authAPITimeout)
-	resp, err := ctxhttp.Do(ctx, nil, req)
+// attempt sends req once and decodes the response into dst.  It returns the
+// status code of the response, zero on a connection error, and the delay
+// requested by its Retry-After header.
+func (h *requestHandler) attempt(ctx context.Context, req *http.Request, api *apiSettings, dst interface{}) (int, time.Duration, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, authAPITimeout)
+		defer cancel()
+	}
+	resp, err := ctxhttp.Do(ctx, h.client, req)
 	if err != nil {
-		cancel()
-		return err
+		return 0, 0, err
 	}
 	defer resp.Body.Close()
 	if err = loadHTTPResponse(resp, dst); err != nil {
-		return err
+		return resp.StatusCode, retryAfter(resp), err
 	}
 	if api.respFn != nil {
 		if err = api.respFn(dst); err != nil {
-			return err
+			return resp.StatusCode, 0, err
 		}
 	}
-	return nil
+	return resp.StatusCode, 0, nil
 }
 
 func isValidUID(uid string) bool {
@@ -412,6 +824,43 @@ func isValidEmail(email string) bool {
 	return match
 }
 
+// isValidPhoneNumber tells whether phoneNumber is in E.164 format.
+func isValidPhoneNumber(phoneNumber string) bool {
+	match, _ := regexp.MatchString(`^\+[1-9][0-9]{1,14}$`, phoneNumber)
+	return match
+}
+
+// maxCustomClaimsSize is the maximum size of the serialized custom claims.
+const maxCustomClaimsSize = 1000
+
+// marshalCustomClaims validates the given custom claims and returns them
+// serialized to JSON.  Nil claims are serialized to "{}".
+func marshalCustomClaims(claims map[string]interface{}) (string, error) {
+	if claims == nil {
+		return "{}", nil
+	}
+	for key := range claims {
+		if isReserved(key) {
+			return "", &APIError{
+				Code:    AuthErrForbiddenClaim.Code,
+				Message: fmt.Sprintf("Developer claim %q is reserved and cannot be specified.", key),
+			}
+		}
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", &APIError{
+			Code:    AuthErrInvalidClaims.Code,
+			Message: AuthErrInvalidClaims.Message,
+			Err:     err,
+		}
+	}
+	if len(b) > maxCustomClaimsSize {
+		return "", AuthErrClaimsTooLarge
+	}
+	return string(b), nil
+}
+
 func isValidPassword(password string) bool {
 	size := len(password)
 	return size >= 6
@@ -435,83 +884,3 @@ func isValidURL(urlString string) bool {
 	}
 	return true
 }
-
-func isEmptyValue(val interface{}) bool {
-	return reflect.DeepEqual(val, reflect.Zero(reflect.TypeOf(val)).Interface())
-}
-
-var (
-	validCreateEditKeys = map[string]bool{
-		"displayName":     true,
-		"localId":         true,
-		"email":           true,
-		"password":        true,
-		"rawPassword":     true,
-		"emailVerified":   true,
-		"photoUrl":        true,
-		"disabled":        true,
-		"disableUser":     true,
-		"deleteAttribute": true,
-		"sanityCheck":     true,
-		"phoneNumber":     true,
-	}
-)
-
-func validateCreateEditRequest(r map[string]interface{}) error {
-	for key := range r {
-		if _, allowed := validCreateEditKeys[key]; !allowed {
-			delete(r, key)
-		}
-	}
-	if val, exists := r["displayName"]; exists {
-		if _, ok := val.(string); !ok {
-			return AuthErrInvalidDisplayName
-		}
-	}
-	if val, exists := r["localId"]; exists {
-		if uid, ok := val.(string); !ok || !isValidUID(uid) {
-			return AuthErrInvalidUID
-		}
-	}
-	if val, exists := r["email"]; exists {
-		if email, ok := val.(string); !ok || !isValidEmail(email) {
-			return AuthErrInvalidEmail
-		}
-	}
-	if val, exists := r["password"]; exists {
-		if pw, ok := val.(string); !ok || !isValidPassword(pw) {
-			return AuthErrInvalidPassword
-		}
-	}
-	if val, exists := r["rawPassword"]; exists {
-		if pw, ok := val.(string); !ok || !isValidPassword(pw) {
-			return AuthErrInvalidPassword
-		}
-	}
-	if val, exists := r["emailVerified"]; exists {
-		if _, ok := val.(bool); !ok {
-			return AuthErrInvalidEmailVerified
-		}
-	}
-	if val, exists := r["photoUrl"]; exists {
-		if urlString, ok := val.(string); !ok || !isValidURL(urlString) {
-			return AuthErrInvalidPhotoURL
-		}
-	}
-	if val, exists := r["disabled"]; exists {
-		if _, ok := val.(bool); !ok {
-			return AuthErrInvalidDisabledField
-		}
-	}
-	if val, exists := r["disableUser"]; exists {
-		if _, ok := val.(bool); !ok {
-			return AuthErrInvalidDisabledField
-		}
-	}
-	if val, exists := r["phoneNumber"]; exists {
-		if _, ok := val.(string); !ok {
-			return AuthErrInvalidPhoneNumber
-		}
-	}
-	return nil
-}
@@ -0,0 +1,475 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallWithContext(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	defer close(done)
+
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := auth.DeleteUserWithContext(ctx, "myuid")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < authAPITimeout)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, auth.DeleteUserWithContext(ctx, "myuid"))
+}
+
+// newGetAccountInfoServer returns a server finding the users with an even
+// uid, the given emails and phone numbers, recording the requests.
+func newGetAccountInfoServer(requests *[]getAccountInfoRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req getAccountInfoRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*requests = append(*requests, req)
+
+		var resp getAccountInfoResponse
+		for _, uid := range req.LocalID {
+			var n int
+			fmt.Sscanf(uid, "user%d", &n)
+			if n%2 == 0 {
+				resp.Users = append(resp.Users, &accountInfo{LocalID: uid})
+			}
+		}
+		for _, email := range req.Email {
+			resp.Users = append(resp.Users, &accountInfo{LocalID: "email-user", Email: email})
+		}
+		for _, phone := range req.PhoneNumber {
+			resp.Users = append(resp.Users, &accountInfo{LocalID: "phone-user", PhoneNumber: phone})
+		}
+		for _, id := range req.FederatedUserID {
+			resp.Users = append(resp.Users, &accountInfo{
+				LocalID:          "provider-user",
+				ProviderUserInfo: []*providerInfo{{ProviderID: id.ProviderID, RawID: id.RawID}},
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestGetUsers(t *testing.T) {
+	var requests []getAccountInfoRequest
+	server := newGetAccountInfoServer(&requests)
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	var identifiers []UserIdentifier
+	for i := 0; i < 147; i++ {
+		identifiers = append(identifiers, UIDIdentifier{UID: fmt.Sprintf("user%d", i)})
+	}
+	identifiers = append(identifiers,
+		EmailIdentifier{Email: "user@example.com"},
+		PhoneIdentifier{PhoneNumber: "+15555550100"},
+		ProviderIdentifier{ProviderID: "google.com", ProviderUID: "google-uid"},
+	)
+	result, err := auth.GetUsers(identifiers)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, 100, requests[0].count())
+	assert.Equal(t, 50, requests[1].count())
+	assert.Equal(t, []string{"user@example.com"}, requests[1].Email)
+	assert.Equal(t, []*federatedUserIdentifier{{ProviderID: "google.com", RawID: "google-uid"}}, requests[1].FederatedUserID)
+	assert.Len(t, result.Users, 74+3)
+	assert.Len(t, result.NotFound, 73)
+	assert.Equal(t, UIDIdentifier{UID: "user1"}, result.NotFound[0])
+}
+
+func TestGetUsersInvalidIdentifier(t *testing.T) {
+	auth := newEmulatedAuth("localhost:0")
+	cases := []struct {
+		id   UserIdentifier
+		want error
+	}{
+		{UIDIdentifier{}, AuthErrInvalidUID},
+		{EmailIdentifier{Email: "not-an-email"}, AuthErrInvalidEmail},
+		{PhoneIdentifier{PhoneNumber: "5555550100"}, AuthErrInvalidPhoneNumber},
+		{ProviderIdentifier{ProviderUID: "uid"}, AuthErrInvalidProviderID},
+		{ProviderIdentifier{ProviderID: "google.com"}, AuthErrInvalidProviderUID},
+	}
+	for _, tc := range cases {
+		_, err := auth.GetUsers([]UserIdentifier{tc.id})
+		assert.Equal(t, tc.want, err)
+	}
+
+	result, err := auth.GetUsers(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Users)
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"kind":"identitytoolkit#GetAccountInfoResponse"}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	_, err := auth.GetUser("myuid")
+	assert.True(t, IsUserNotFound(err))
+}
+
+func TestGetUserByPhoneNumberAndProviderUID(t *testing.T) {
+	var requests []getAccountInfoRequest
+	server := newGetAccountInfoServer(&requests)
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	user, err := auth.GetUserByPhoneNumber("+15555550100")
+	assert.NoError(t, err)
+	assert.Equal(t, "phone-user", user.UID)
+	assert.Equal(t, "+15555550100", user.PhoneNumber)
+	assert.Equal(t, []string{"+15555550100"}, requests[0].PhoneNumber)
+
+	user, err = auth.GetUserByProviderUID("google.com", "google-uid")
+	assert.NoError(t, err)
+	assert.Equal(t, "provider-user", user.UID)
+	assert.Equal(t, "google-uid", user.ProviderData[0].UID)
+	assert.Equal(t, []*federatedUserIdentifier{{ProviderID: "google.com", RawID: "google-uid"}}, requests[1].FederatedUserID)
+
+	for _, phone := range []string{"", "5555550100", "+0555", "+1 555 555 0100", "+1234567890123456"} {
+		_, err = auth.GetUserByPhoneNumber(phone)
+		assert.Equal(t, AuthErrInvalidPhoneNumber, err, phone)
+	}
+	_, err = auth.GetUserByProviderUID("", "google-uid")
+	assert.Equal(t, AuthErrInvalidProviderID, err)
+	assert.Len(t, requests, 2)
+}
+
+func TestDeleteUsers(t *testing.T) {
+	var paths []string
+	var requests []batchDeleteAccountsRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var req batchDeleteAccountsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		if len(requests) == 2 {
+			w.Write([]byte(`{"errors":[{"index":3,"localId":"user1003","message":"NOT_DISABLED : Disable the account before batch deletion."}]}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	uids := make([]string, 1500)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("user%d", i)
+	}
+	result, err := auth.DeleteUsersWithOptions(context.Background(), uids, &DeleteUsersOptions{OnlyDisabled: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1499, result.SuccessCount)
+	assert.Equal(t, 1, result.FailureCount)
+	assert.Equal(t, []*DeleteUsersErrorInfo{{
+		Index:  1003,
+		UID:    "user1003",
+		Reason: "NOT_DISABLED : Disable the account before batch deletion.",
+	}}, result.Errors)
+
+	assert.Len(t, requests, 2)
+	assert.Len(t, requests[0].LocalIDs, 1000)
+	assert.Len(t, requests[1].LocalIDs, 500)
+	assert.False(t, requests[0].Force)
+	assert.Equal(t, "/identitytoolkit.googleapis.com/v1/projects/"+testProjectID+"/accounts:batchDelete", paths[0])
+
+	_, err = auth.DeleteUsers([]string{"myuid"})
+	assert.NoError(t, err)
+	assert.True(t, requests[2].Force)
+	_, err = auth.DeleteUsersWithOptions(context.Background(), []string{"myuid"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, requests[3].Force)
+
+	_, err = auth.DeleteUsers([]string{"myuid", ""})
+	assert.Equal(t, AuthErrInvalidUID, err)
+	assert.Len(t, requests, 4)
+
+	result, err = auth.DeleteUsers(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.SuccessCount)
+
+	defer setEnv(projectEnvVar, "")()
+	auth.app.options.ProjectID = ""
+	_, err = auth.DeleteUsers([]string{"myuid"})
+	assert.Equal(t, AuthErrProjectIDMissing, err)
+	assert.Len(t, requests, 4)
+}
+
+func TestSetCustomUserClaims(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		w.Write([]byte(`{"localId":"myuid"}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	err := auth.SetCustomUserClaims("myuid", map[string]interface{}{"admin": true, "level": 5})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"localId":          "myuid",
+		"customAttributes": `{"admin":true,"level":5}`,
+	}, requests[0])
+
+	assert.NoError(t, auth.SetCustomUserClaims("myuid", nil))
+	assert.Equal(t, "{}", requests[1]["customAttributes"])
+
+	err = auth.SetCustomUserClaims("myuid", map[string]interface{}{"iss": "me"})
+	assert.True(t, errors.Is(err, AuthErrForbiddenClaim))
+	err = auth.SetCustomUserClaims("myuid", map[string]interface{}{"key": strings.Repeat("x", 1000)})
+	assert.Equal(t, AuthErrClaimsTooLarge, err)
+	err = auth.SetCustomUserClaims("myuid", map[string]interface{}{"key": func() {}})
+	assert.True(t, errors.Is(err, AuthErrInvalidClaims))
+	assert.Equal(t, AuthErrInvalidUID, auth.SetCustomUserClaims("", nil))
+	assert.Len(t, requests, 2)
+}
+
+func TestUserRecordCustomClaims(t *testing.T) {
+	user, err := newUserRecord(&accountInfo{
+		LocalID:          "myuid",
+		CustomAttributes: `{"admin":true,"roles":["editor"]}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"admin": true,
+		"roles": []interface{}{"editor"},
+	}, user.CustomClaims)
+
+	user, err = newUserRecord(&accountInfo{LocalID: "myuid"})
+	assert.NoError(t, err)
+	assert.Nil(t, user.CustomClaims)
+
+	_, err = newUserRecord(&accountInfo{LocalID: "myuid", CustomAttributes: "{"})
+	assert.True(t, IsInternalError(err))
+}
+
+func TestUserRecordFromAccountInfo(t *testing.T) {
+	var resp getAccountInfoResponse
+	err := json.Unmarshal([]byte(`{"users":[{
+		"localId": "myuid",
+		"email": "user@example.com",
+		"phoneNumber": "+15555550100",
+		"emailVerified": true,
+		"passwordHash": "aGFzaA==",
+		"salt": "c2FsdA==",
+		"validSince": "1500000000",
+		"createdAt": "1400000000000",
+		"lastLoginAt": "1500000000000",
+		"lastRefreshAt": "2017-07-14T02:40:00.5Z",
+		"tenantId": "tenant-1",
+		"customAttributes": "{\"admin\":true}",
+		"mfaInfo": [{
+			"mfaEnrollmentId": "enrollment-1",
+			"displayName": "work phone",
+			"phoneInfo": "+15555550199",
+			"enrolledAt": "2017-07-01T00:00:00Z"
+		}],
+		"providerUserInfo": [
+			{"providerId": "phone", "rawId": "+15555550100", "phoneNumber": "+15555550100"},
+			{"providerId": "google.com", "rawId": "google-uid", "email": "user@gmail.com"}
+		]
+	}]}`), &resp)
+	assert.NoError(t, err)
+	user, err := newUserRecord(resp.Users[0])
+	assert.NoError(t, err)
+
+	assert.Equal(t, &UserRecord{
+		UID:                    "myuid",
+		Email:                  "user@example.com",
+		PhoneNumber:            "+15555550100",
+		EmailVerified:          true,
+		PasswordHash:           "aGFzaA==",
+		PasswordSalt:           "c2FsdA==",
+		TokensValidAfterMillis: 1500000000000,
+		TenantID:               "tenant-1",
+		CustomClaims:           map[string]interface{}{"admin": true},
+		Metadata: &UserMetadata{
+			CreatedAt:       time.Unix(1400000000, 0).UTC(),
+			LastSignedIn:    time.Unix(1500000000, 0).UTC(),
+			LastRefreshTime: time.Date(2017, 7, 14, 2, 40, 0, 500000000, time.UTC),
+		},
+		MultiFactor: &MultiFactorSettings{
+			EnrolledFactors: []*MultiFactorInfo{{
+				UID:            "enrollment-1",
+				DisplayName:    "work phone",
+				FactorID:       "phone",
+				PhoneNumber:    "+15555550199",
+				EnrollmentTime: time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC),
+			}},
+		},
+		ProviderData: []*UserInfo{
+			{ProviderID: "phone", UID: "+15555550100", PhoneNumber: "+15555550100"},
+			{ProviderID: "google.com", UID: "google-uid", Email: "user@gmail.com"},
+		},
+	}, user)
+
+	b, err := json.Marshal(user)
+	assert.NoError(t, err)
+	var cached UserRecord
+	assert.NoError(t, json.Unmarshal(b, &cached))
+	assert.Equal(t, user, &cached)
+}
+
+func TestUserRecordUnknownTimes(t *testing.T) {
+	user, err := newUserRecord(&accountInfo{LocalID: "myuid", LastRefreshAt: "yesterday"})
+	assert.NoError(t, err)
+	assert.True(t, user.Metadata.CreatedAt.IsZero())
+	assert.True(t, user.Metadata.LastSignedIn.IsZero())
+	assert.True(t, user.Metadata.LastRefreshTime.IsZero())
+	assert.Nil(t, user.MultiFactor)
+}
+
+func TestUserToCreate(t *testing.T) {
+	req, err := (&UserToCreate{}).
+		UID("myuid").
+		Email("user@example.com").
+		EmailVerified(true).
+		Password("secret").
+		DisplayName("User").
+		PhotoURL("https://example.com/photo.png").
+		Disabled(false).
+		PhoneNumber("+15555550100").
+		request()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"localId":       "myuid",
+		"email":         "user@example.com",
+		"emailVerified": true,
+		"password":      "secret",
+		"displayName":   "User",
+		"photoUrl":      "https://example.com/photo.png",
+		"disabled":      false,
+		"phoneNumber":   "+15555550100",
+	}, req)
+
+	req, err = (&UserToCreate{}).request()
+	assert.NoError(t, err)
+	assert.Empty(t, req)
+
+	cases := []struct {
+		user *UserToCreate
+		want error
+	}{
+		{(&UserToCreate{}).UID(""), AuthErrInvalidUID},
+		{(&UserToCreate{}).UID(strings.Repeat("a", 129)), AuthErrInvalidUID},
+		{(&UserToCreate{}).Email("user"), AuthErrInvalidEmail},
+		{(&UserToCreate{}).Password("short"), AuthErrInvalidPassword},
+		{(&UserToCreate{}).DisplayName(""), AuthErrInvalidDisplayName},
+		{(&UserToCreate{}).PhotoURL("ftp://example.com"), AuthErrInvalidPhotoURL},
+		{(&UserToCreate{}).PhoneNumber("5555550100"), AuthErrInvalidPhoneNumber},
+	}
+	for _, tc := range cases {
+		_, err := tc.user.request()
+		assert.Equal(t, tc.want, err, "%v", tc.user.params)
+	}
+}
+
+func TestUserToUpdate(t *testing.T) {
+	req, err := (&UserToUpdate{}).
+		Email("user@example.com").
+		EmailVerified(true).
+		Password("secret").
+		DisplayName("").
+		PhotoURL("").
+		Disabled(true).
+		PhoneNumber("").
+		CustomClaims(map[string]interface{}{"admin": true}).
+		request()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"email":            "user@example.com",
+		"emailVerified":    true,
+		"password":         "secret",
+		"disableUser":      true,
+		"deleteAttribute":  []string{"DISPLAY_NAME", "PHOTO_URL"},
+		"deleteProvider":   []string{"phone"},
+		"customAttributes": `{"admin":true}`,
+	}, req)
+
+	req, err = (&UserToUpdate{}).DisplayName("User").PhoneNumber("+15555550100").CustomClaims(nil).request()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"displayName":      "User",
+		"phoneNumber":      "+15555550100",
+		"customAttributes": "{}",
+	}, req)
+
+	cases := []struct {
+		user *UserToUpdate
+		want error
+	}{
+		{(&UserToUpdate{}).Email(""), AuthErrInvalidEmail},
+		{(&UserToUpdate{}).Password(""), AuthErrInvalidPassword},
+		{(&UserToUpdate{}).PhotoURL("not a url"), AuthErrInvalidPhotoURL},
+		{(&UserToUpdate{}).PhoneNumber("+1 555"), AuthErrInvalidPhoneNumber},
+		{(&UserToUpdate{}).CustomClaims(map[string]interface{}{"key": strings.Repeat("x", 1000)}), AuthErrClaimsTooLarge},
+	}
+	for _, tc := range cases {
+		_, err := tc.user.request()
+		assert.Equal(t, tc.want, err, "%v", tc.user.params)
+	}
+}
+
+func TestUpdateUserValidation(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	_, err := auth.UpdateUser("myuid", (&UserToUpdate{}).Email("invalid"))
+	assert.Equal(t, AuthErrInvalidEmail, err)
+	_, err = auth.UpdateUser("myuid", nil)
+	assert.Equal(t, errNullUserProperty, err)
+	_, err = auth.CreateUser((&UserToCreate{}).PhoneNumber("555"))
+	assert.Equal(t, AuthErrInvalidPhoneNumber, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestRevokeRefreshTokens(t *testing.T) {
+	var setAccountInfo map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/setAccountInfo") {
+			json.NewDecoder(r.Body).Decode(&setAccountInfo)
+			w.Write([]byte(`{"localId":"myuid"}`))
+			return
+		}
+		w.Write([]byte(`{"users":[{"localId":"myuid"}]}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	before := time.Now().Unix()
+	assert.NoError(t, auth.RevokeRefreshTokens("myuid"))
+	assert.Equal(t, "myuid", setAccountInfo["localId"])
+	validSince, err := strconv.ParseInt(setAccountInfo["validSince"].(string), 10, 64)
+	assert.NoError(t, err)
+	assert.True(t, validSince >= before)
+}
@@ -2,10 +2,12 @@ package firebase
 
 import (
 	"strconv"
+	"strings"
 	"time"
 )
 
 // UserRecord defines the data model for Firebase interface representing a user.
+// It can be marshaled to JSON, e.g. to be cached, and unmarshaled back.
 type UserRecord struct {
 	UID                    string
 	DisplayName            string
@@ -17,6 +19,11 @@ type UserRecord struct {
 	Disabled               bool
 	Metadata               *UserMetadata
 	PhoneNumber            string
+	CustomClaims           map[string]interface{} // set with SetCustomUserClaims.
+	PasswordHash           string                 // base64 encoded, only set for users with a password.
+	PasswordSalt           string                 // base64 encoded, only set for users with a password.
+	TenantID               string
+	MultiFactor            *MultiFactorSettings // nil if no second factor is enrolled.
 }
 
 // UserInfo defines the data model for Firebase interface representing a user's info from a third-party
@@ -31,73 +38,295 @@ type UserInfo struct {
 }
 
 // UserMetadata defines the data model for Firebase interface representing a user's metadata.
+// Unknown times are zero.
 type UserMetadata struct {
-	CreatedAt    time.Time
-	LastSignedIn time.Time
+	CreatedAt       time.Time
+	LastSignedIn    time.Time
+	LastRefreshTime time.Time
 }
 
-// UserProperties defines the input user properties in a create or edit user API.
+// phoneMultiFactorID is the FactorID of the SMS second factors.
+const phoneMultiFactorID = "phone"
+
+// MultiFactorSettings defines the data model for the second factors enrolled
+// by a user.
+type MultiFactorSettings struct {
+	EnrolledFactors []*MultiFactorInfo
+}
+
+// MultiFactorInfo defines the data model for a second factor enrolled by a
+// user.
+type MultiFactorInfo struct {
+	UID            string
+	DisplayName    string
+	FactorID       string // "phone" for SMS second factors.
+	PhoneNumber    string
+	EnrollmentTime time.Time
+}
+
+// UserIdentifier identifies a user to look up with GetUsers.  It is one of
+// UIDIdentifier, EmailIdentifier, PhoneIdentifier or ProviderIdentifier.
+type UserIdentifier interface {
+	validate() error
+	populate(req *getAccountInfoRequest)
+	matches(user *UserRecord) bool
+}
+
+// UIDIdentifier identifies a user by uid.
+type UIDIdentifier struct {
+	UID string
+}
+
+func (id UIDIdentifier) validate() error {
+	if !isValidUID(id.UID) {
+		return AuthErrInvalidUID
+	}
+	return nil
+}
+
+func (id UIDIdentifier) populate(req *getAccountInfoRequest) {
+	req.LocalID = append(req.LocalID, id.UID)
+}
+
+func (id UIDIdentifier) matches(user *UserRecord) bool {
+	return id.UID == user.UID
+}
+
+// EmailIdentifier identifies a user by email.
+type EmailIdentifier struct {
+	Email string
+}
+
+func (id EmailIdentifier) validate() error {
+	if !isValidEmail(id.Email) {
+		return AuthErrInvalidEmail
+	}
+	return nil
+}
+
+func (id EmailIdentifier) populate(req *getAccountInfoRequest) {
+	req.Email = append(req.Email, id.Email)
+}
+
+func (id EmailIdentifier) matches(user *UserRecord) bool {
+	return strings.EqualFold(id.Email, user.Email)
+}
+
+// PhoneIdentifier identifies a user by phone number, in E.164 format.
+type PhoneIdentifier struct {
+	PhoneNumber string
+}
+
+func (id PhoneIdentifier) validate() error {
+	if !isValidPhoneNumber(id.PhoneNumber) {
+		return AuthErrInvalidPhoneNumber
+	}
+	return nil
+}
+
+func (id PhoneIdentifier) populate(req *getAccountInfoRequest) {
+	req.PhoneNumber = append(req.PhoneNumber, id.PhoneNumber)
+}
+
+func (id PhoneIdentifier) matches(user *UserRecord) bool {
+	return id.PhoneNumber == user.PhoneNumber
+}
+
+// ProviderIdentifier identifies a user by the uid given by an identity
+// provider, e.g. "google.com".
+type ProviderIdentifier struct {
+	ProviderID  string
+	ProviderUID string
+}
+
+func (id ProviderIdentifier) validate() error {
+	if id.ProviderID == "" {
+		return AuthErrInvalidProviderID
+	}
+	if id.ProviderUID == "" {
+		return AuthErrInvalidProviderUID
+	}
+	return nil
+}
+
+func (id ProviderIdentifier) populate(req *getAccountInfoRequest) {
+	req.FederatedUserID = append(req.FederatedUserID, &federatedUserIdentifier{
+		ProviderID: id.ProviderID,
+		RawID:      id.ProviderUID,
+	})
+}
+
+func (id ProviderIdentifier) matches(user *UserRecord) bool {
+	for _, info := range user.ProviderData {
+		if info.ProviderID == id.ProviderID && info.UID == id.ProviderUID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUsersResult is the result of GetUsers.
+type GetUsersResult struct {
+	// Users are the users found, in no particular order.
+	Users []*UserRecord
+	// NotFound are the identifiers matching no user.
+	NotFound []UserIdentifier
+}
+
+// DeleteUsersOptions are the options of DeleteUsersWithOptions.  Nil options
+// or the zero value delete the users like DeleteUsers.
+type DeleteUsersOptions struct {
+	// OnlyDisabled only deletes the disabled users, and reports the others as
+	// failures.  By default the users are deleted whether they are disabled or
+	// not.
+	OnlyDisabled bool
+}
+
+// DeleteUsersResult is the result of DeleteUsers.
+type DeleteUsersResult struct {
+	// SuccessCount is the number of users deleted.
+	SuccessCount int
+	// FailureCount is the number of users that could not be deleted.
+	FailureCount int
+	// Errors describe the users that could not be deleted.
+	Errors []*DeleteUsersErrorInfo
+}
+
+// DeleteUsersErrorInfo describes a user that could not be deleted.
+type DeleteUsersErrorInfo struct {
+	// Index is the index of the user in the uids given to DeleteUsers.
+	Index int
+	// UID is the uid of the user.
+	UID string
+	// Reason is the error message returned by the server.
+	Reason string
+}
+
+// UserToCreate defines the properties of a user created with CreateUser.  The
+// properties are validated before any request is sent, and the ones left unset
+// take their default values:
 //
-// Note that user attributes without setup in create actions will remain in default values.
-// And attributes without setup in edit actions are remaining unchanged.
-type UserProperties map[string]interface{}
+//	user := (&UserToCreate{}).Email("user@example.com").Password("secret")
+type UserToCreate struct {
+	params map[string]interface{}
+}
 
-// SetUID sets the uid to assign to the newly created user.
+func (u *UserToCreate) set(key string, val interface{}) *UserToCreate {
+	if u.params == nil {
+		u.params = make(map[string]interface{})
+	}
+	u.params[key] = val
+	return u
+}
+
+// UID sets the uid to assign to the newly created user.
 // Must be a string between 1 and 128 characters long, inclusive.
 // If not provided, a random uid will be automatically generated.
+func (u *UserToCreate) UID(uid string) *UserToCreate {
+	return u.set("localId", uid)
+}
+
+// Email sets the user's primary email. Must be a valid email address.
+func (u *UserToCreate) Email(email string) *UserToCreate {
+	return u.set("email", email)
+}
+
+// EmailVerified sets whether or not the user's primary email is verified.
+func (u *UserToCreate) EmailVerified(emailVerified bool) *UserToCreate {
+	return u.set("emailVerified", emailVerified)
+}
+
+// Password sets the user's raw, unhashed password.
+// Must be at least six characters long.
+func (u *UserToCreate) Password(password string) *UserToCreate {
+	return u.set("password", password)
+}
+
+// DisplayName sets the user's display name. Must not be empty.
+func (u *UserToCreate) DisplayName(displayName string) *UserToCreate {
+	return u.set("displayName", displayName)
+}
+
+// PhotoURL sets the user's photo URL. Must be a valid http or https URL.
+func (u *UserToCreate) PhotoURL(photoURL string) *UserToCreate {
+	return u.set("photoUrl", photoURL)
+}
+
+// Disabled sets whether or not the user is disabled.
+func (u *UserToCreate) Disabled(disabled bool) *UserToCreate {
+	return u.set("disabled", disabled)
+}
+
+// PhoneNumber sets the user's primary phone number.
+// Must be a valid E.164 spec compliant phone number.
+func (u *UserToCreate) PhoneNumber(phoneNumber string) *UserToCreate {
+	return u.set("phoneNumber", phoneNumber)
+}
+
+// UserToUpdate defines the properties of a user changed with UpdateUser.  The
+// properties are validated before any request is sent, and the ones left unset
+// remain unchanged:
 //
-// Note that this property takes no effects in update user actions.
-func (p UserProperties) SetUID(uid string) UserProperties {
-	p["uid"] = uid
-	return p
+//	user := (&UserToUpdate{}).DisplayName("").EmailVerified(true)
+type UserToUpdate struct {
+	params map[string]interface{}
 }
 
-// SetEmail sets the user's primary email. Must be a valid email address.
-func (p UserProperties) SetEmail(email string) UserProperties {
-	p["email"] = email
-	return p
+func (u *UserToUpdate) set(key string, val interface{}) *UserToUpdate {
+	if u.params == nil {
+		u.params = make(map[string]interface{})
+	}
+	u.params[key] = val
+	return u
 }
 
-// SetEmailVerified sets whether or not the user's primary email is verified.
-func (p UserProperties) SetEmailVerified(emailVerified bool) UserProperties {
-	p["emailVerified"] = emailVerified
-	return p
+// Email sets the user's primary email. Must be a valid email address.
+func (u *UserToUpdate) Email(email string) *UserToUpdate {
+	return u.set("email", email)
 }
 
-// SetPassword sets the user's raw, unhashed password.
+// EmailVerified sets whether or not the user's primary email is verified.
+func (u *UserToUpdate) EmailVerified(emailVerified bool) *UserToUpdate {
+	return u.set("emailVerified", emailVerified)
+}
+
+// Password sets the user's raw, unhashed password.
 // Must be at least six characters long.
-func (p UserProperties) SetPassword(password string) UserProperties {
-	p["password"] = password
-	return p
+func (u *UserToUpdate) Password(password string) *UserToUpdate {
+	return u.set("password", password)
+}
+
+// DisplayName sets the user's display name.
+// Passing an empty string removes the display name from the user record.
+func (u *UserToUpdate) DisplayName(displayName string) *UserToUpdate {
+	return u.set("displayName", displayName)
 }
 
-// SetDisplayName sets the users' display name.
-// Only passing an empty string in edit actions removes the display name in the user record.
-func (p UserProperties) SetDisplayName(displayName string) UserProperties {
-	p["displayName"] = displayName
-	return p
+// PhotoURL sets the user's photo URL. Must be a valid http or https URL.
+// Passing an empty string removes the photo URL from the user record.
+func (u *UserToUpdate) PhotoURL(photoURL string) *UserToUpdate {
+	return u.set("photoUrl", photoURL)
 }
 
-// SetPhotoURL sets the user's photo URL.
-// Only passing an empty string in edit actions removes the photo URL in the user record.
-func (p UserProperties) SetPhotoURL(photoURL string) UserProperties {
-	p["photoURL"] = photoURL
-	return p
+// Disabled sets whether or not the user is disabled.
+func (u *UserToUpdate) Disabled(disabled bool) *UserToUpdate {
+	return u.set("disableUser", disabled)
 }
 
-// SetDisabled sets whether or not the user is disabled
-func (p UserProperties) SetDisabled(disabled bool) UserProperties {
-	p["disabled"] = disabled
-	return p
+// PhoneNumber sets the user's primary phone number.
+// Must be a valid E.164 spec compliant phone number.
+// Passing an empty string unlinks the phone number from the user record.
+func (u *UserToUpdate) PhoneNumber(phoneNumber string) *UserToUpdate {
+	return u.set("phoneNumber", phoneNumber)
 }
 
-// The user's new primary phone number. Must be a valid E.164 spec compliant phone number.
-func (p UserProperties) SetPhoneNumber(phoneNumber string) UserProperties {
-	p["phoneNumber"] = phoneNumber
-	return p
+// CustomClaims sets the user's custom claims, with the same restrictions as
+// SetCustomUserClaims.  Passing nil removes the custom claims.
+func (u *UserToUpdate) CustomClaims(claims map[string]interface{}) *UserToUpdate {
+	return u.set("customAttributes", claims)
 }
 
-func (p UserProperties) SetValidSince(valid time.Time) UserProperties {
-	p["validSince"] = strconv.FormatInt(valid.Unix(), 10)
-	return p
+// validSince invalidates the tokens of the user issued before the given time.
+func (u *UserToUpdate) validSince(valid time.Time) *UserToUpdate {
+	return u.set("validSince", strconv.FormatInt(valid.Unix(), 10))
 }
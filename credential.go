@@ -4,13 +4,33 @@ import (
 	"crypto/rsa"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 
 	"github.com/SermoDigital/jose/crypto"
 	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/jwt"
 )
 
+// Credential supplies the OAuth 2.0 access tokens used to call Google APIs
+// and, if it holds a private key, the Signer used to mint custom tokens.
+type Credential interface {
+	// TokenSource returns the token source authorizing calls to Google APIs.
+	// The HTTP client of Options is passed in ctx under the oauth2.HTTPClient
+	// key.
+	TokenSource(ctx context.Context) (oauth2.TokenSource, error)
+	// Signer returns the signer for custom tokens, or nil if the credential
+	// cannot sign.
+	Signer() Signer
+}
+
+const (
+	serviceAccountType = "service_account"
+	authorizedUserType = "authorized_user"
+)
+
 // GoogleServiceAccountCredential is the credential for a GCP Service Account.
 type GoogleServiceAccountCredential struct {
 	// ProjectID is the project ID.
@@ -47,6 +67,105 @@ func (c *GoogleServiceAccountCredential) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// tokenURLKey is the context key of the OAuth 2.0 token URL overriding the
+// Google token URLs, see Options.TokenURL.
+type tokenURLKey struct{}
+
+// tokenURLFromContext returns the token URL set in ctx, or the given default.
+func tokenURLFromContext(ctx context.Context, defaultURL string) string {
+	if u, ok := ctx.Value(tokenURLKey{}).(string); ok && u != "" {
+		return u
+	}
+	return defaultURL
+}
+
+// TokenSource returns a token source using the JWT flow of the Service Account.
+func (c *GoogleServiceAccountCredential) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	cfg := &jwt.Config{
+		Email:      c.ClientEmail,
+		PrivateKey: []byte(c.PrivateKeyString),
+		Scopes:     append([]string{}, scopes...),
+		TokenURL:   tokenURLFromContext(ctx, jwtTokenURL),
+	}
+	return cfg.TokenSource(ctx), nil
+}
+
+// Signer returns a signer using the private key of the Service Account.
+func (c *GoogleServiceAccountCredential) Signer() Signer {
+	if c.PrivateKey == nil {
+		return nil
+	}
+	return &rsaSigner{email: c.ClientEmail, key: c.PrivateKey}
+}
+
+// RefreshTokenCredential is the credential for a Google user account, such as
+// the authorized_user file written by `gcloud auth application-default login`.
+type RefreshTokenCredential struct {
+	// ClientID is the OAuth 2.0 client ID.
+	ClientID string `json:"client_id"`
+	// ClientSecret is the OAuth 2.0 client secret.
+	ClientSecret string `json:"client_secret"`
+	// RefreshToken is the OAuth 2.0 refresh token.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenSource returns a token source exchanging the refresh token for access tokens.
+func (c *RefreshTokenCredential) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.RefreshToken == "" {
+		return nil, errors.New("refresh token cannot be empty")
+	}
+	cfg := &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  tokenURLFromContext(ctx, refreshTokenURL),
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		Scopes: append([]string{}, scopes...),
+	}
+	return cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: c.RefreshToken}), nil
+}
+
+// Signer returns nil, user accounts cannot sign custom tokens.
+func (c *RefreshTokenCredential) Signer() Signer {
+	return nil
+}
+
+// AccessTokenCredential is a credential holding a raw OAuth 2.0 access token,
+// which is used as-is and never refreshed.
+type AccessTokenCredential struct {
+	// AccessToken is the OAuth 2.0 access token.
+	AccessToken string
+}
+
+// TokenSource returns a token source always returning the access token.
+func (c *AccessTokenCredential) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.AccessToken == "" {
+		return nil, errors.New("access token cannot be empty")
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.AccessToken}), nil
+}
+
+// Signer returns nil, access tokens cannot sign custom tokens.
+func (c *AccessTokenCredential) Signer() Signer {
+	return nil
+}
+
+// metadataCredential is the credential of the default service account of a
+// GCE instance, as served by the metadata server.
+type metadataCredential struct {
+	ts       oauth2.TokenSource
+	metadata *metadataTokenSource
+}
+
+func (c *metadataCredential) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	return c.ts, nil
+}
+
+func (c *metadataCredential) Signer() Signer {
+	return nil
+}
+
 // loadCredential loads the Service Account credential from a JSON file.
 func loadCredential(r io.Reader) (*GoogleServiceAccountCredential, error) {
 	var c GoogleServiceAccountCredential
@@ -56,13 +175,46 @@ func loadCredential(r io.Reader) (*GoogleServiceAccountCredential, error) {
 	return &c, nil
 }
 
+// loadAnyCredential loads a credential from a JSON file, choosing the
+// credential type from the "type" field of the file.
+func loadAnyCredential(r io.Reader) (Credential, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, err
+	}
+	switch header.Type {
+	case serviceAccountType, "":
+		c := new(GoogleServiceAccountCredential)
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	case authorizedUserType:
+		c := new(RefreshTokenCredential)
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unsupported credential type: %q", header.Type)
+}
+
 const (
 	// jwtTokenURL is Google's OAuth 2.0 token URL to use with the JWT flow.
 	jwtTokenURL = "https://accounts.google.com/o/oauth2/token"
+	// refreshTokenURL is Google's OAuth 2.0 token URL to use with refresh tokens.
+	refreshTokenURL = "https://oauth2.googleapis.com/token"
 )
 
 var (
 	scopes = []string{
+		"https://www.googleapis.com/auth/cloud-platform",
 		"https://www.googleapis.com/auth/userinfo.email",
 		"https://www.googleapis.com/auth/firebase.database",
 		"https://www.googleapis.com/auth/firebase.messaging",
@@ -76,17 +228,64 @@ func (auth *Auth) ensureTokenSource() error {
 	if auth.ts != nil {
 		return nil
 	}
-	cred := auth.app.options.ServiceAccountCredential
-	if cred == nil {
-		return errors.New("no service account credential found")
+	o := auth.app.options
+	if o.authEmulatorHost() != "" {
+		auth.ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: emulatorAccessToken})
+		return nil
+	}
+	if err := o.ensureCredential(); err != nil {
+		return err
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, o.httpClient())
+	if o.TokenURL != "" {
+		ctx = context.WithValue(ctx, tokenURLKey{}, o.TokenURL)
 	}
+	ts, err := o.Credential.TokenSource(ctx)
+	if err != nil {
+		return err
+	}
+	auth.ts = ts
+	return nil
+}
 
-	cfg := &jwt.Config{
-		Email:      cred.ClientEmail,
-		PrivateKey: []byte(cred.PrivateKeyString),
-		Scopes:     append([]string{}, scopes...),
-		TokenURL:   jwtTokenURL,
+// ensureSigner sets the Signer used to mint custom tokens.  Options.Signer
+// takes precedence and needs no credential.  Otherwise a credential holding a
+// private key signs in-process, or tokens are signed through the IAM signBlob
+// API on behalf of the configured service account.
+func (auth *Auth) ensureSigner() error {
+	auth.signerLock.Lock()
+	defer auth.signerLock.Unlock()
+	if auth.signer != nil {
+		return nil
+	}
+	o := auth.app.options
+	if o.authEmulatorHost() != "" {
+		auth.signer = emulatorSigner{}
+		return nil
+	}
+	if o.Signer != nil {
+		auth.signer = o.Signer
+		return nil
+	}
+	if err := auth.ensureTokenSource(); err != nil {
+		return err
+	}
+	if s := o.Credential.Signer(); s != nil {
+		auth.signer = s
+		return nil
+	}
+	email := o.ServiceAccountEmail
+	if email == "" {
+		if c, ok := o.Credential.(*metadataCredential); ok {
+			var err error
+			if email, err = c.metadata.email(); err != nil {
+				return fmt.Errorf("cannot find the service account email: %v", err)
+			}
+		}
+	}
+	if email == "" {
+		return errors.New("the credential cannot sign custom tokens; set ServiceAccountEmail to sign through IAM")
 	}
-	auth.ts = cfg.TokenSource(context.TODO())
+	auth.signer = newIAMSigner(email, o.IAMEndpoint, auth.ts, o.httpClient())
 	return nil
 }
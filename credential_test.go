@@ -1,7 +1,9 @@
 package firebase
 
 import (
+	"context"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,3 +21,54 @@ func TestCredential(t *testing.T) {
 	assert.Equal(t, "myapp-dev@appspot.gserviceaccount.com", c.ClientEmail)
 	assert.NotNil(t, c.PrivateKey)
 }
+
+func TestLoadAnyCredential(t *testing.T) {
+	f, err := os.Open("testdata/service-account-appengine.json")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	c, err := loadAnyCredential(f)
+	assert.NoError(t, err)
+	sa, ok := c.(*GoogleServiceAccountCredential)
+	assert.True(t, ok)
+	assert.Equal(t, "myapp-dev", sa.ProjectID)
+	assert.NotNil(t, c.Signer())
+	assert.Equal(t, "myapp-dev@appspot.gserviceaccount.com", c.Signer().Email())
+}
+
+func TestLoadAuthorizedUserCredential(t *testing.T) {
+	f, err := os.Open("testdata/authorized-user.json")
+	assert.NoError(t, err)
+	defer f.Close()
+
+	c, err := loadAnyCredential(f)
+	assert.NoError(t, err)
+	rt, ok := c.(*RefreshTokenCredential)
+	assert.True(t, ok)
+	assert.Equal(t, "myapp-client.apps.googleusercontent.com", rt.ClientID)
+	assert.Equal(t, "myapp-secret", rt.ClientSecret)
+	assert.Equal(t, "myapp-refresh-token", rt.RefreshToken)
+	assert.Nil(t, c.Signer())
+
+	ts, err := c.TokenSource(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, ts)
+}
+
+func TestLoadUnsupportedCredential(t *testing.T) {
+	_, err := loadAnyCredential(strings.NewReader(`{"type": "external_account"}`))
+	assert.EqualError(t, err, `unsupported credential type: "external_account"`)
+}
+
+func TestAccessTokenCredential(t *testing.T) {
+	c := &AccessTokenCredential{AccessToken: "my-access-token"}
+	ts, err := c.TokenSource(context.Background())
+	assert.NoError(t, err)
+	token, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "my-access-token", token.AccessToken)
+	assert.Nil(t, c.Signer())
+
+	_, err = (&AccessTokenCredential{}).TokenSource(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+package firebase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// credentialsEnvVar is the environment variable holding the path of a
+	// credential JSON file, as defined by Application Default Credentials.
+	credentialsEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
+	// projectEnvVar is the environment variable holding the GCP project ID.
+	projectEnvVar = "GOOGLE_CLOUD_PROJECT"
+	// metadataHostEnvVar is the environment variable overriding the host of
+	// the GCE metadata server.
+	metadataHostEnvVar = "GCE_METADATA_HOST"
+	// defaultMetadataEndpoint is the base URL of the GCE metadata server.
+	defaultMetadataEndpoint = "http://metadata.google.internal/computeMetadata/v1/"
+	// metadataTimeout bounds the probe of the metadata server, which is not
+	// reachable at all outside of Google Cloud.
+	metadataTimeout = time.Second * 3
+)
+
+var (
+	errNoDefaultCredentials = errors.New("could not find default credentials; " +
+		"set ServiceAccountPath or the " + credentialsEnvVar + " environment variable")
+)
+
+// metadataEndpoint returns the base URL of the metadata server to use.
+func (o *Options) metadataEndpoint() string {
+	if o.MetadataEndpoint != "" {
+		return withEndpoint(o.MetadataEndpoint)
+	}
+	if host := os.Getenv(metadataHostEnvVar); host != "" {
+		return "http://" + host + "/computeMetadata/v1/"
+	}
+	return defaultMetadataEndpoint
+}
+
+// findDefaultCredentials looks up credentials the way Application Default
+// Credentials does: the file named by GOOGLE_APPLICATION_CREDENTIALS, then the
+// well-known file written by gcloud, then the GCE metadata server.
+func (o *Options) findDefaultCredentials() error {
+	if path := os.Getenv(credentialsEnvVar); path != "" {
+		c, err := loadCredentialFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", credentialsEnvVar, err)
+		}
+		o.setCredential(c)
+		return nil
+	}
+
+	if path := wellKnownCredentialFile(); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			c, err := loadCredentialFile(path)
+			if err != nil {
+				return fmt.Errorf("gcloud credential file %s: %v", path, err)
+			}
+			o.setCredential(c)
+			return nil
+		}
+	}
+
+	ts := newMetadataTokenSource(o.metadataEndpoint(), o.httpClient())
+	projectID, err := ts.projectID()
+	if err != nil {
+		return errNoDefaultCredentials
+	}
+	if o.projectID() == "" {
+		o.ProjectID = projectID
+	}
+	o.Credential = &metadataCredential{
+		ts:       oauth2.ReuseTokenSource(nil, ts),
+		metadata: ts,
+	}
+	return nil
+}
+
+// loadCredentialFile loads the credential from the JSON file at the given path.
+func loadCredentialFile(path string) (Credential, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Credential file cannot be opened: %s %v", path, err)
+	}
+	defer f.Close()
+	return loadAnyCredential(f)
+}
+
+// wellKnownCredentialFile returns the path of the file written by
+// `gcloud auth application-default login`.
+func wellKnownCredentialFile() string {
+	const f = "application_default_credentials.json"
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Join(dir, f)
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, "gcloud", f)
+		}
+		return ""
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "gcloud", f)
+	}
+	return ""
+}
+
+// metadataTokenSource is an oauth2.TokenSource fetching access tokens of the
+// default service account from the GCE metadata server.
+type metadataTokenSource struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newMetadataTokenSource(endpoint string, client *http.Client) *metadataTokenSource {
+	return &metadataTokenSource{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+// get issues a GET request for the given metadata path and returns the body.
+func (ts *metadataTokenSource) get(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", ts.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+	resp, err := ctxhttp.Do(ctx, ts.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata server returned %d for %s: %s", resp.StatusCode, path, string(body))
+	}
+	return body, nil
+}
+
+// projectID returns the project ID of the instance, which doubles as a probe
+// for the availability of the metadata server.
+func (ts *metadataTokenSource) projectID() (string, error) {
+	b, err := ts.get("project/project-id")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// email returns the email of the default service account of the instance.
+func (ts *metadataTokenSource) email() (string, error) {
+	b, err := ts.get("instance/service-accounts/default/email")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Token fetches a new access token from the metadata server.
+func (ts *metadataTokenSource) Token() (*oauth2.Token, error) {
+	b, err := ts.get("instance/service-accounts/default/token")
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	if res.AccessToken == "" {
+		return nil, errors.New("metadata server returned an empty access token")
+	}
+	return &oauth2.Token{
+		AccessToken: res.AccessToken,
+		TokenType:   res.TokenType,
+		Expiry:      time.Now().Add(time.Duration(res.ExpiresIn) * time.Second),
+	}, nil
+}
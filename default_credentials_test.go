@@ -0,0 +1,65 @@
+package firebase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCredentialsFromEnv(t *testing.T) {
+	defer setEnv(credentialsEnvVar, "testdata/service-account-computeengine.json")()
+
+	o := &Options{}
+	assert.NoError(t, o.ensureCredential())
+	assert.NotNil(t, o.ServiceAccountCredential)
+	assert.NotNil(t, o.ServiceAccountCredential.PrivateKey)
+	assert.Equal(t, o.ServiceAccountCredential, o.Credential)
+}
+
+func TestDefaultCredentialsFromWellKnownFile(t *testing.T) {
+	defer setEnv(credentialsEnvVar, "")()
+	defer setEnv("CLOUDSDK_CONFIG", "testdata/gcloud")()
+
+	o := &Options{}
+	assert.NoError(t, o.ensureCredential())
+	assert.NotNil(t, o.ServiceAccountCredential)
+	assert.Equal(t, "myapp-dev", o.projectID())
+}
+
+func TestDefaultCredentialsFromMetadataServer(t *testing.T) {
+	defer setEnv(credentialsEnvVar, "")()
+	defer setEnv("CLOUDSDK_CONFIG", "testdata/nonexistent")()
+	defer setEnv(projectEnvVar, "")()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/project/project-id":
+			w.Write([]byte("metadata-project"))
+		case "/instance/service-accounts/default/token":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"metadata-token","expires_in":3600,"token_type":"Bearer"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	o := &Options{MetadataEndpoint: server.URL}
+	assert.NoError(t, o.ensureCredential())
+	assert.Nil(t, o.ServiceAccountCredential)
+	assert.Nil(t, o.Credential.Signer())
+	assert.Equal(t, "metadata-project", o.projectID())
+
+	auth := &Auth{app: &App{options: o}}
+	assert.NoError(t, auth.ensureTokenSource())
+	token, err := auth.ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "metadata-token", token.AccessToken)
+	assert.True(t, token.Valid())
+}
@@ -0,0 +1,78 @@
+package firebase
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newEmulatedAuth(host string) *Auth {
+	return &Auth{app: &App{options: &Options{
+		AuthEmulatorHost: host,
+		ProjectID:        testProjectID,
+	}}}
+}
+
+func TestEmulatorRequests(t *testing.T) {
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, auth.DeleteUser("myuid"))
+	assert.Equal(t, "/www.googleapis.com/identitytoolkit/v3/relyingparty/deleteAccount", gotPath)
+	assert.Equal(t, "Bearer owner", gotAuth)
+}
+
+func TestEmulatorHostFromEnv(t *testing.T) {
+	defer setEnv(authEmulatorHostEnvVar, "localhost:9099")()
+	o := &Options{}
+	assert.Equal(t, "localhost:9099", o.authEmulatorHost())
+	assert.Equal(t, "http://localhost:9099/www.googleapis.com/identitytoolkit/v3/relyingparty/", o.authAPIEndpoint())
+	assert.Equal(t, "http://localhost:9099/identitytoolkit.googleapis.com/v1/", o.authAPIV1Endpoint())
+
+	o.AuthEmulatorHost = "127.0.0.1:9000"
+	assert.Equal(t, "127.0.0.1:9000", o.authEmulatorHost())
+}
+
+func TestEmulatorCustomToken(t *testing.T) {
+	auth := newEmulatedAuth("localhost:9099")
+	token, err := auth.CreateCustomToken("myuid", nil)
+	assert.NoError(t, err)
+
+	segments := strings.Split(token, ".")
+	assert.Len(t, segments, 3)
+	var header jwtHeader
+	assert.NoError(t, decode(segments[0], &header))
+	assert.Equal(t, "none", header.Algorithm)
+	var payload Token
+	assert.NoError(t, decode(segments[1], &payload))
+	assert.Equal(t, emulatorServiceAccountEmail, payload.Issuer)
+	assert.Equal(t, "", segments[2])
+}
+
+func TestEmulatorVerifyIDToken(t *testing.T) {
+	now := time.Now().Unix()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(
+		`{"iss":"https://securetoken.google.com/%s","aud":"%s","sub":"myuid","iat":%d,"exp":%d}`,
+		testProjectID, testProjectID, now, now+3600)))
+
+	auth := newEmulatedAuth("localhost:9099")
+	token, err := auth.VerifyIDToken(header + "." + payload + ".")
+	assert.NoError(t, err)
+	assert.Equal(t, "myuid", token.UID)
+
+	_, err = auth.VerifyIDToken(header + ".e30.")
+	assert.Error(t, err)
+}
@@ -1,8 +1,9 @@
 package firebase
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 )
 
 // The default auth errors definitions.
@@ -58,6 +59,36 @@ var (
 		Code:    "auth/invalid-email",
 		Message: "The email address is improperly formatted.",
 	}
+	// AuthErrInvalidClaims represents the default api error that
+	// the provided custom claims are invalid.
+	AuthErrInvalidClaims = &APIError{
+		Code:    "auth/invalid-claims",
+		Message: "The custom claims must be serializable to JSON.",
+	}
+	// AuthErrClaimsTooLarge represents the default api error that
+	// the provided custom claims exceed the maximum size.
+	AuthErrClaimsTooLarge = &APIError{
+		Code:    "auth/claims-too-large",
+		Message: "The custom claims must not exceed 1000 bytes once serialized.",
+	}
+	// AuthErrForbiddenClaim represents the default api error that
+	// the provided custom claims contain a reserved claim name.
+	AuthErrForbiddenClaim = &APIError{
+		Code:    "auth/forbidden-claim",
+		Message: "The custom claims must not contain a reserved claim name.",
+	}
+	// AuthErrInvalidHashAlgorithm represents the default api error that
+	// the provided password hash algorithm is missing or invalid.
+	AuthErrInvalidHashAlgorithm = &APIError{
+		Code:    "auth/invalid-hash-algorithm",
+		Message: "The hash algorithm must be one of the supported algorithms.",
+	}
+	// AuthErrMaximumUserCountExceeded represents the default api error that
+	// too many users were provided to ImportUsers.
+	AuthErrMaximumUserCountExceeded = &APIError{
+		Code:    "auth/maximum-user-count-exceeded",
+		Message: "At most 1000 users can be imported at once.",
+	}
 	// AuthErrInvalidPassword represents the default api error that
 	// the provided value for the password user property is invalid.
 	AuthErrInvalidPassword = &APIError{
@@ -70,6 +101,18 @@ var (
 		Code:    "auth/invalid-photo-url",
 		Message: "The photoURL field must be a valid URL.",
 	}
+	// AuthErrInvalidProviderID represents the default api error that
+	// the provided provider ID is invalid.
+	AuthErrInvalidProviderID = &APIError{
+		Code:    "auth/invalid-provider-id",
+		Message: "The provider ID must be a non-empty string.",
+	}
+	// AuthErrInvalidProviderUID represents the default api error that
+	// the provided provider uid is invalid.
+	AuthErrInvalidProviderUID = &APIError{
+		Code:    "auth/invalid-provider-uid",
+		Message: "The provider uid must be a non-empty string.",
+	}
 	// AuthErrInvalidUID represents the default api error that the provided uid is invalid.
 	// It must be a non-empty string with at most 128 characters.
 	AuthErrInvalidUID = &APIError{
@@ -95,6 +138,12 @@ var (
 		Code:    "auth/project-not-found",
 		Message: "No Firebase project was found for the provided credential.",
 	}
+	// AuthErrProjectIDMissing represents the default api error that
+	// the project ID required by the requested operation is not available.
+	AuthErrProjectIDMissing = &APIError{
+		Code:    "auth/project-id-missing",
+		Message: "The project ID is not available; set it in the options or the GOOGLE_CLOUD_PROJECT environment variable.",
+	}
 	// AuthErrInsufficientPermission represents the default api error that
 	// the credential used to initialize the SDK has insufficient permission
 	// to access the requested Authentication resource.
@@ -116,11 +165,23 @@ var (
 		Code:    "auth/user-not-found",
 		Message: "There is no user record corresponding to the provided identifier.",
 	}
-	// AuthErrInvalidPassword represents the default api error that
-	// the provided value for the password user property is invalid.
+	// AuthErrInvalidPhoneNumber represents the default api error that
+	// the provided value for the phoneNumber user property is invalid.
 	AuthErrInvalidPhoneNumber = &APIError{
 		Code:    "auth/invalid-phone-number",
-		Message: "The phoneNumber must be a string.",
+		Message: "The phoneNumber must be a non-empty E.164 standard compliant identifier string.",
+	}
+	// AuthErrInvalidIDToken represents the default api error that
+	// the provided ID token is not a valid Firebase ID token.
+	AuthErrInvalidIDToken = &APIError{
+		Code:    "auth/invalid-id-token",
+		Message: "The provided ID token is not a valid Firebase ID token.",
+	}
+	// AuthErrInvalidSessionCookieDuration represents the default api error that
+	// the provided session cookie duration is out of range.
+	AuthErrInvalidSessionCookieDuration = &APIError{
+		Code:    "auth/invalid-session-cookie-duration",
+		Message: "The session cookie duration must be between 5 minutes and 2 weeks.",
 	}
 )
 
@@ -138,6 +199,10 @@ var (
 		"EMAIL_EXISTS": AuthErrEmailAlreadyExists,
 		// Invalid email provided.
 		"INVALID_EMAIL": AuthErrInvalidEmail,
+		// createSessionCookie provides an invalid ID token.
+		"INVALID_ID_TOKEN": AuthErrInvalidIDToken,
+		// createSessionCookie provides an out of range duration.
+		"INVALID_SESSION_COOKIE_DURATION": AuthErrInvalidSessionCookieDuration,
 		// No localId provided (deleteAccount missing localId).
 		"MISSING_LOCAL_ID": AuthErrMissingUID,
 		// Empty user list in uploadAccount.
@@ -153,25 +218,218 @@ var (
 	}
 )
 
-func authFromServerError(errorCode string, raw interface{}) error {
-	err, ok := authServerToClientCodes[errorCode]
+// authFromServerError returns a new APIError for the error code returned by
+// the server, e.g. "USER_NOT_FOUND" or "INVALID_EMAIL : details".  Unknown
+// codes are reported as internal errors with the raw server response.
+func authFromServerError(status int, errorCode string, raw []byte) *APIError {
+	serverCode := strings.TrimSpace(strings.SplitN(errorCode, ":", 2)[0])
+	base, ok := authServerToClientCodes[serverCode]
 	if !ok {
-		err = AuthErrInternalError
+		base = AuthErrInternalError
 	}
-	if err.Code == AuthErrInternalError.Code && raw != nil {
-		if rawBytes, _ := json.Marshal(raw); len(rawBytes) > 0 {
-			err.Message = fmt.Sprintf("%s Raw server response \"%s\"", err.Message, string(rawBytes))
-		}
+	err := &APIError{
+		Code:       base.Code,
+		Message:    base.Message,
+		Status:     status,
+		ServerCode: serverCode,
+		Raw:        raw,
+	}
+	if !ok && len(raw) > 0 {
+		err.Message = fmt.Sprintf("%s Raw server response \"%s\"", err.Message, string(raw))
 	}
 	return err
 }
 
 // APIError defines the data model of Firebase API errors.
+//
+// A new APIError is returned for every failed call.  It matches the AuthErr
+// variable of the same Code with errors.Is, for instance
+// errors.Is(err, AuthErrUserNotFound).
 type APIError struct {
-	Code    string
+	// Code is the Firebase error code, e.g. "auth/user-not-found".
+	Code string
+	// Message is the description of the error.
 	Message string
+	// Status is the HTTP status code of the response, or zero if the error
+	// was not returned by the server.
+	Status int
+	// ServerCode is the error code returned by the server, e.g. "USER_NOT_FOUND".
+	ServerCode string
+	// Raw is the raw body of the error response.
+	Raw []byte
+	// Err is the underlying cause of the error, if any.
+	Err error
 }
 
 func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("code: %s, message: %s: %v", e.Code, e.Message, e.Err)
+	}
 	return fmt.Sprintf("code: %s, message: %s", e.Code, e.Message)
 }
+
+// Unwrap returns the underlying cause of the error.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an APIError with the same Code.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// IsUserNotFound reports whether err is an AuthErrUserNotFound error.
+func IsUserNotFound(err error) bool {
+	return errors.Is(err, AuthErrUserNotFound)
+}
+
+// IsEmailAlreadyExists reports whether err is an AuthErrEmailAlreadyExists error.
+func IsEmailAlreadyExists(err error) bool {
+	return errors.Is(err, AuthErrEmailAlreadyExists)
+}
+
+// IsUIDAlreadyExists reports whether err is an AuthErrUIDAlreadyExists error.
+func IsUIDAlreadyExists(err error) bool {
+	return errors.Is(err, AuthErrUIDAlreadyExists)
+}
+
+// IsInsufficientPermission reports whether err is an
+// AuthErrInsufficientPermission error.
+func IsInsufficientPermission(err error) bool {
+	return errors.Is(err, AuthErrInsufficientPermission)
+}
+
+// IsProjectNotFound reports whether err is an AuthErrProjectNotFound error.
+func IsProjectNotFound(err error) bool {
+	return errors.Is(err, AuthErrProjectNotFound)
+}
+
+// IsInternalError reports whether err is an AuthErrInternalError error.
+func IsInternalError(err error) bool {
+	return errors.Is(err, AuthErrInternalError)
+}
+
+// The token verification errors definitions.  The errors returned when
+// verifying ID tokens and session cookies match them with errors.Is.
+var (
+	// TokenErrIDTokenExpired is the error of an expired ID token.
+	TokenErrIDTokenExpired = &TokenError{
+		Code:    "id-token-expired",
+		Message: "The ID token has expired.",
+	}
+	// TokenErrIDTokenRevoked is the error of a revoked ID token.
+	TokenErrIDTokenRevoked = &TokenError{
+		Code:    "id-token-revoked",
+		Message: "The ID token has been revoked.",
+	}
+	// TokenErrSessionCookieExpired is the error of an expired session cookie.
+	TokenErrSessionCookieExpired = &TokenError{
+		Code:    "session-cookie-expired",
+		Message: "The session cookie has expired.",
+	}
+	// TokenErrSessionCookieRevoked is the error of a revoked session cookie.
+	TokenErrSessionCookieRevoked = &TokenError{
+		Code:    "session-cookie-revoked",
+		Message: "The session cookie has been revoked.",
+	}
+	// TokenErrIssuedInFuture is the error of a token whose 'iat' (issued at)
+	// claim is in the future.
+	TokenErrIssuedInFuture = &TokenError{
+		Code:    "issued-in-future",
+		Message: "The token was issued in the future.",
+	}
+	// TokenErrInvalidAudience is the error of a token whose 'aud' (audience)
+	// claim is not the project ID.
+	TokenErrInvalidAudience = &TokenError{
+		Code:    "invalid-audience",
+		Message: "The token has an invalid audience.",
+	}
+	// TokenErrInvalidIssuer is the error of a token whose 'iss' (issuer)
+	// claim does not match the project ID.
+	TokenErrInvalidIssuer = &TokenError{
+		Code:    "invalid-issuer",
+		Message: "The token has an invalid issuer.",
+	}
+	// TokenErrInvalidSubject is the error of a token whose 'sub' (subject)
+	// claim is empty or longer than 128 characters.
+	TokenErrInvalidSubject = &TokenError{
+		Code:    "invalid-subject",
+		Message: "The token has an invalid subject.",
+	}
+	// TokenErrMissingKeyID is the error of a token without 'kid' header.
+	TokenErrMissingKeyID = &TokenError{
+		Code:    "missing-kid",
+		Message: "The token has no key ID.",
+	}
+	// TokenErrInvalidAlgorithm is the error of a token not signed with RS256.
+	TokenErrInvalidAlgorithm = &TokenError{
+		Code:    "invalid-algorithm",
+		Message: "The token has an invalid algorithm.",
+	}
+	// TokenErrInvalidSignature is the error of a token whose signature cannot
+	// be verified with the public keys.
+	TokenErrInvalidSignature = &TokenError{
+		Code:    "invalid-signature",
+		Message: "The token has an invalid signature.",
+	}
+	// TokenErrMalformed is the error of a string that cannot be decoded as a
+	// JWT, or a custom token given in place of an ID token.
+	TokenErrMalformed = &TokenError{
+		Code:    "malformed-token",
+		Message: "The token is malformed.",
+	}
+	// TokenErrCertificateFetchFailed is the error of a failure to fetch the
+	// public keys verifying the token signatures.
+	TokenErrCertificateFetchFailed = &TokenError{
+		Code:    "certificate-fetch-failed",
+		Message: "The public keys could not be fetched.",
+	}
+	// TokenErrProjectIDMissing is the error of a token verification without
+	// project ID to check the token against.
+	TokenErrProjectIDMissing = &TokenError{
+		Code:    "project-id-missing",
+		Message: "The project ID is not available.",
+	}
+	// TokenErrUserDisabled is the error of a valid ID token or session cookie
+	// of a disabled user, reported when checking revocation.
+	TokenErrUserDisabled = &TokenError{
+		Code:    "user-disabled",
+		Message: "The user record is disabled.",
+	}
+)
+
+// TokenError defines the data model of the ID token and session cookie
+// verification errors.
+type TokenError struct {
+	// Code is the error code, e.g. "id-token-expired".
+	Code string
+	// Message is the description of the error.
+	Message string
+	// Claim is the name of the offending claim or header, e.g. "exp" or "aud".
+	Claim string
+	// Value is the value of Claim in the token.
+	Value interface{}
+	// Expected is the value Claim was expected to have, if any.
+	Expected interface{}
+	// Err is the underlying cause of the error, if any.
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("code: %s, message: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("code: %s, message: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a TokenError with the same Code.
+func (e *TokenError) Is(target error) bool {
+	t, ok := target.(*TokenError)
+	return ok && t.Code == e.Code
+}
@@ -0,0 +1,78 @@
+package firebase
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthFromServerError(t *testing.T) {
+	message := AuthErrInternalError.Message
+	for i := 0; i < 2; i++ {
+		err := authFromServerError(500, "UNKNOWN", []byte(`{"error":{"message":"UNKNOWN"}}`))
+		assert.Equal(t, AuthErrInternalError.Code, err.Code)
+		assert.Equal(t, 500, err.Status)
+		assert.Equal(t, "UNKNOWN", err.ServerCode)
+		assert.Contains(t, err.Message, `Raw server response "{"error":{"message":"UNKNOWN"}}"`)
+		assert.True(t, err != AuthErrInternalError)
+	}
+	assert.Equal(t, message, AuthErrInternalError.Message)
+
+	err := authFromServerError(400, "INVALID_EMAIL : bad email", nil)
+	assert.Equal(t, AuthErrInvalidEmail.Code, err.Code)
+	assert.Equal(t, AuthErrInvalidEmail.Message, err.Message)
+	assert.Equal(t, "INVALID_EMAIL", err.ServerCode)
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	var err error = authFromServerError(400, "USER_NOT_FOUND", nil)
+	assert.True(t, errors.Is(err, AuthErrUserNotFound))
+	assert.False(t, errors.Is(err, AuthErrEmailAlreadyExists))
+	assert.True(t, IsUserNotFound(fmt.Errorf("lookup failed: %w", err)))
+	assert.False(t, IsEmailAlreadyExists(err))
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 400, apiErr.Status)
+
+	cause := errors.New("cause")
+	err = &APIError{Code: AuthErrInternalError.Code, Err: cause}
+	assert.True(t, errors.Is(err, cause))
+	assert.True(t, IsInternalError(err))
+}
+
+func TestAPIErrorFromResponse(t *testing.T) {
+	body := `{"error":{"code":400,"message":"EMAIL_EXISTS"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/deleteAccount") {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>Bad Gateway</html>"))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+	auth.app.options.RetryPolicy = &RetryPolicy{}
+
+	_, err := auth.CreateUser((&UserToCreate{}).Email("user@example.com"))
+	assert.True(t, IsEmailAlreadyExists(err))
+	apiErr, ok := err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, "EMAIL_EXISTS", apiErr.ServerCode)
+	assert.Equal(t, body, string(apiErr.Raw))
+
+	err = auth.DeleteUser("myuid")
+	assert.True(t, IsInternalError(err))
+	apiErr, ok = err.(*APIError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadGateway, apiErr.Status)
+	assert.NotNil(t, apiErr.Err)
+}
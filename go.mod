@@ -1,11 +1,13 @@
 module github.com/retrorabbit/firebase-server-sdk-go
 
-go 1.12
+go 1.13
 
 require (
 	github.com/SermoDigital/jose v0.9.2-0.20180104203859-803625baeddc
+	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.3.0
 	golang.org/x/net v0.0.0-20190503192946-f4e77d36d62c
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	google.golang.org/api v0.15.0
+	google.golang.org/grpc v1.20.1
 )
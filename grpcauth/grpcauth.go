@@ -0,0 +1,184 @@
+// Package grpcauth authenticates gRPC calls with Firebase ID tokens.
+//
+// The server interceptors verify the ID token sent in the "authorization"
+// metadata as "Bearer <ID token>", and add the decoded token to the context of
+// the call, where it is returned by firebase.TokenFromContext.  The clients
+// attach the ID tokens with TokenCredentials.
+package grpcauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	firebase "github.com/retrorabbit/firebase-server-sdk-go"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures the server interceptors.
+type Options struct {
+	// CheckRevoked rejects the revoked ID tokens and the ID tokens of
+	// disabled users, at the cost of a request to the Auth API per call.
+	CheckRevoked bool
+	// RequiredClaims are the claims the ID token must have, e.g. custom
+	// claims set with SetCustomUserClaims.  A nil value only requires the
+	// claim to be present, other values must be equal to the claim as decoded
+	// from JSON, e.g. float64 for numbers.  Calls missing a claim fail with
+	// codes.PermissionDenied.
+	RequiredClaims map[string]interface{}
+	// AllowedMethods are the full names of the methods, e.g.
+	// "/grpc.health.v1.Health/Check", called without authentication.  Their
+	// ID token is still verified if present.
+	AllowedMethods []string
+}
+
+// UnaryServerInterceptor returns a server interceptor authenticating the
+// unary calls.  Calls without a valid ID token fail with
+// codes.Unauthenticated, unless their method is allowed by opts.
+func UnaryServerInterceptor(auth *firebase.Auth, opts *Options) grpc.UnaryServerInterceptor {
+	a := newAuthenticator(auth, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor authenticating the
+// streaming calls, like UnaryServerInterceptor.
+func StreamServerInterceptor(auth *firebase.Auth, opts *Options) grpc.StreamServerInterceptor {
+	a := newAuthenticator(auth, opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+type authenticator struct {
+	auth    *firebase.Auth
+	opts    *Options
+	allowed map[string]bool
+}
+
+func newAuthenticator(auth *firebase.Auth, opts *Options) *authenticator {
+	if opts == nil {
+		opts = &Options{}
+	}
+	allowed := make(map[string]bool, len(opts.AllowedMethods))
+	for _, m := range opts.AllowedMethods {
+		allowed[m] = true
+	}
+	return &authenticator{auth: auth, opts: opts, allowed: allowed}
+}
+
+// authenticate verifies the ID token of the call to the given method, and
+// returns the context of the call with the decoded token.
+func (a *authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	idToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if idToken == "" {
+		if a.allowed[method] {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "the call has no ID token")
+	}
+	var token *firebase.Token
+	if a.opts.CheckRevoked {
+		token, err = a.auth.VerifyIDTokenAndCheckRevokedWithContext(ctx, idToken)
+	} else {
+		token, err = a.auth.VerifyIDTokenWithContext(ctx, idToken)
+	}
+	if err != nil {
+		return nil, verificationError(err)
+	}
+	if name, missing := token.MissingClaim(a.opts.RequiredClaims); missing {
+		return nil, status.Errorf(codes.PermissionDenied, "the ID token is missing the required claim %q", name)
+	}
+	return firebase.NewContextWithToken(ctx, token), nil
+}
+
+// bearerToken returns the ID token of the "authorization" metadata of the
+// incoming call, or an empty string if there is none.
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", nil
+	}
+	parts := strings.SplitN(values[0], " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", status.Error(codes.Unauthenticated, `the authorization metadata must be "Bearer <ID token>"`)
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
+
+// verificationError returns the status of an ID token verification failure:
+// codes.Unauthenticated for invalid tokens, and codes.Unavailable when the
+// token could not be verified, e.g. when the public keys cannot be fetched.
+func verificationError(err error) error {
+	var tErr *firebase.TokenError
+	switch {
+	case errors.As(err, &tErr):
+		if tErr.Is(firebase.TokenErrCertificateFetchFailed) || tErr.Is(firebase.TokenErrProjectIDMissing) {
+			return status.Error(codes.Unavailable, "the ID token could not be verified")
+		}
+		return status.Error(codes.Unauthenticated, fmt.Sprintf("%s: %s", tErr.Code, tErr.Message))
+	case firebase.IsUserNotFound(err):
+		return status.Error(codes.Unauthenticated, "the user of the ID token does not exist")
+	default:
+		return status.Error(codes.Unavailable, "the ID token could not be verified")
+	}
+}
+
+// TokenCredentials attaches the ID tokens of a token source, e.g. returned by
+// Auth.IDTokenSource, to the outgoing calls.  It implements
+// credentials.PerRPCCredentials:
+//
+//	conn, err := grpc.Dial(target,
+//		grpc.WithTransportCredentials(creds),
+//		grpc.WithPerRPCCredentials(&grpcauth.TokenCredentials{TokenSource: ts}))
+type TokenCredentials struct {
+	TokenSource oauth2.TokenSource
+	// AllowInsecure sends the ID tokens on connections without transport
+	// security, e.g. to local servers.
+	AllowInsecure bool
+}
+
+// GetRequestMetadata returns the "authorization" metadata of a call.
+func (c *TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.TokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"authorization": "Bearer " + token.AccessToken,
+	}, nil
+}
+
+// RequireTransportSecurity tells whether the ID tokens require a connection
+// with transport security.
+func (c *TokenCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
@@ -0,0 +1,180 @@
+package grpcauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	firebase "github.com/retrorabbit/firebase-server-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testProjectID = "mock-project-id"
+
+// appCount numbers the Apps of the tests, whose names must be unique across
+// repeated runs.
+var appCount int32
+
+// newEmulatedAuth returns an Auth instance of a new App using the Auth
+// Emulator at the given host, which accepts unsigned ID tokens.
+func newEmulatedAuth(t *testing.T, host string) *firebase.Auth {
+	name := fmt.Sprintf("%s-%d", t.Name(), atomic.AddInt32(&appCount, 1))
+	app, err := firebase.InitializeAppWithName(&firebase.Options{
+		AuthEmulatorHost: host,
+		ProjectID:        testProjectID,
+		RetryPolicy:      &firebase.RetryPolicy{},
+	}, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := firebase.GetAuthWithApp(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+// unsignedIDToken returns an ID token as issued by the Auth Emulator.
+func unsignedIDToken(claims map[string]interface{}) string {
+	payload := map[string]interface{}{
+		"iss": "https://securetoken.google.com/" + testProjectID,
+		"aud": testProjectID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"sub": "myuid",
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	b, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(b) + "."
+}
+
+func incoming(authorization string) context.Context {
+	md := metadata.MD{}
+	if authorization != "" {
+		md = metadata.Pairs("authorization", authorization)
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+// callUnary calls the interceptor, and returns the token passed to the handler.
+func callUnary(interceptor grpc.UnaryServerInterceptor, ctx context.Context, method string) (*firebase.Token, error) {
+	var token *firebase.Token
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		token, _ = firebase.TokenFromContext(ctx)
+		return nil, nil
+	})
+	return token, err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	auth := newEmulatedAuth(t, "localhost:0")
+	interceptor := UnaryServerInterceptor(auth, &Options{AllowedMethods: []string{"/test.Service/Public"}})
+
+	token, err := callUnary(interceptor, incoming("Bearer "+unsignedIDToken(nil)), "/test.Service/Private")
+	assert.NoError(t, err)
+	assert.Equal(t, "myuid", token.UID)
+
+	_, err = callUnary(interceptor, incoming(""), "/test.Service/Private")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = callUnary(interceptor, context.Background(), "/test.Service/Private")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = callUnary(interceptor, incoming("Basic dXNlcjpwYXNz"), "/test.Service/Private")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = callUnary(interceptor, incoming("Bearer invalid"), "/test.Service/Private")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	token, err = callUnary(interceptor, incoming(""), "/test.Service/Public")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+	_, err = callUnary(interceptor, incoming("Bearer invalid"), "/test.Service/Public")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestRequiredClaims(t *testing.T) {
+	auth := newEmulatedAuth(t, "localhost:0")
+	interceptor := UnaryServerInterceptor(auth, &Options{RequiredClaims: map[string]interface{}{"admin": true}})
+
+	token, err := callUnary(interceptor, incoming("Bearer "+unsignedIDToken(map[string]interface{}{"admin": true})), "/test.Service/Method")
+	assert.NoError(t, err)
+	assert.Equal(t, true, token.Claims["admin"])
+
+	_, err = callUnary(interceptor, incoming("Bearer "+unsignedIDToken(nil)), "/test.Service/Method")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = callUnary(interceptor, incoming("Bearer "+unsignedIDToken(map[string]interface{}{"admin": false})), "/test.Service/Method")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestCheckRevoked(t *testing.T) {
+	statusCode := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		w.Write([]byte(`{"users":[{"localId":"myuid","disabled":true}]}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+	interceptor := UnaryServerInterceptor(auth, &Options{CheckRevoked: true})
+	ctx := incoming("Bearer " + unsignedIDToken(nil))
+
+	_, err := callUnary(interceptor, ctx, "/test.Service/Method")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), firebase.TokenErrUserDisabled.Code)
+
+	statusCode = http.StatusServiceUnavailable
+	_, err = callUnary(interceptor, ctx, "/test.Service/Method")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	auth := newEmulatedAuth(t, "localhost:0")
+	interceptor := StreamServerInterceptor(auth, nil)
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+
+	var token *firebase.Token
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		token, _ = firebase.TokenFromContext(stream.Context())
+		return nil
+	}
+	stream := &testServerStream{ctx: incoming("Bearer " + unsignedIDToken(nil))}
+	assert.NoError(t, interceptor(nil, stream, info, handler))
+	assert.Equal(t, "myuid", token.UID)
+
+	err := interceptor(nil, &testServerStream{ctx: incoming("")}, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestTokenCredentials(t *testing.T) {
+	creds := &TokenCredentials{
+		TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "id-token"}),
+	}
+	md, err := creds.GetRequestMetadata(context.Background(), "https://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer id-token"}, md)
+	assert.True(t, creds.RequireTransportSecurity())
+
+	creds.AllowInsecure = true
+	assert.False(t, creds.RequireTransportSecurity())
+}
@@ -0,0 +1,59 @@
+package firebase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestIDTokenSource(t *testing.T) {
+	var paths []string
+	var requests []signInWithCustomTokenRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.String())
+		var req signInWithCustomTokenRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		w.Write([]byte(`{"idToken":"id-token","refreshToken":"refresh-token","expiresIn":"3600"}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	ts := &idTokenSource{ctx: context.Background(), auth: auth, uid: "service-a", apiKey: "api key"}
+	token, err := ts.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "id-token", token.AccessToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, clock.Now().Add(time.Hour), token.Expiry)
+	assert.Equal(t, []string{"/identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken?key=api+key"}, paths)
+	assert.True(t, requests[0].ReturnSecureToken)
+	assert.Len(t, strings.Split(requests[0].Token, "."), 3)
+}
+
+func TestIDTokenSourceErrors(t *testing.T) {
+	body := `{"error":{"code":400,"message":"INVALID_CUSTOM_TOKEN"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(body, "error") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	_, err := auth.IDTokenSource(context.Background(), "service-a", nil, "api-key").Token()
+	assert.Error(t, err)
+
+	body = `{}`
+	_, err = auth.IDTokenSource(context.Background(), "service-a", nil, "api-key").Token()
+	assert.Equal(t, AuthErrInternalError.Code, err.(*APIError).Code)
+
+	_, err = auth.IDTokenSource(context.Background(), "", nil, "api-key").Token()
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package firebase
+
+import (
+	"encoding/base64"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// maxImportUsers is the maximum number of users per uploadAccount request.
+	maxImportUsers = 1000
+)
+
+var (
+	uploadAccountAPI = &apiSettings{
+		method:   "POST",
+		endpoint: "uploadAccount",
+		reqFn: func(src interface{}) error {
+			if r, ok := src.(*uploadAccountRequest); !ok {
+				return errIllegalType
+			} else if len(r.Users) == 0 {
+				return errMissingRequestTarget
+			}
+			return nil
+		},
+		respFn: func(src interface{}) error {
+			if _, ok := src.(*uploadAccountResponse); !ok {
+				return errIllegalType
+			}
+			return nil
+		},
+	}
+)
+
+type uploadAccountRequest struct {
+	*hashConfig
+	Users []*uploadAccountUser `json:"users"`
+}
+
+type uploadAccountUser struct {
+	LocalID          string                `json:"localId"`
+	Email            string                `json:"email,omitempty"`
+	EmailVerified    bool                  `json:"emailVerified,omitempty"`
+	DisplayName      string                `json:"displayName,omitempty"`
+	PhotoURL         string                `json:"photoUrl,omitempty"`
+	PhoneNumber      string                `json:"phoneNumber,omitempty"`
+	Disabled         bool                  `json:"disabled,omitempty"`
+	PasswordHash     string                `json:"passwordHash,omitempty"`
+	Salt             string                `json:"salt,omitempty"`
+	CustomAttributes string                `json:"customAttributes,omitempty"`
+	ProviderUserInfo []*uploadProviderInfo `json:"providerUserInfo,omitempty"`
+	CreatedAt        int64                 `json:"createdAt,omitempty"`
+	LastLoginAt      int64                 `json:"lastLoginAt,omitempty"`
+}
+
+type uploadProviderInfo struct {
+	RawID       string `json:"rawId"`
+	ProviderID  string `json:"providerId"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	PhotoURL    string `json:"photoUrl,omitempty"`
+}
+
+type uploadAccountResponse struct {
+	Errors []*uploadAccountError `json:"error"`
+}
+
+type uploadAccountError struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// newUploadAccountUser validates the user to import and converts it to the
+// uploadAccount format.
+func newUploadAccountUser(u *UserToImport) (*uploadAccountUser, error) {
+	if !isValidUID(u.UID) {
+		return nil, AuthErrInvalidUID
+	}
+	if u.Email != "" && !isValidEmail(u.Email) {
+		return nil, AuthErrInvalidEmail
+	}
+	if u.PhoneNumber != "" && !isValidPhoneNumber(u.PhoneNumber) {
+		return nil, AuthErrInvalidPhoneNumber
+	}
+	if u.PhotoURL != "" && !isValidURL(u.PhotoURL) {
+		return nil, AuthErrInvalidPhotoURL
+	}
+	user := &uploadAccountUser{
+		LocalID:       u.UID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		DisplayName:   u.DisplayName,
+		PhotoURL:      u.PhotoURL,
+		PhoneNumber:   u.PhoneNumber,
+		Disabled:      u.Disabled,
+		PasswordHash:  base64.RawURLEncoding.EncodeToString(u.PasswordHash),
+		Salt:          base64.RawURLEncoding.EncodeToString(u.PasswordSalt),
+	}
+	if u.CustomClaims != nil {
+		claims, err := marshalCustomClaims(u.CustomClaims)
+		if err != nil {
+			return nil, err
+		}
+		user.CustomAttributes = claims
+	}
+	for _, p := range u.ProviderData {
+		if p == nil || p.ProviderID == "" {
+			return nil, AuthErrInvalidProviderID
+		}
+		if p.UID == "" {
+			return nil, AuthErrInvalidProviderUID
+		}
+		user.ProviderUserInfo = append(user.ProviderUserInfo, &uploadProviderInfo{
+			RawID:       p.UID,
+			ProviderID:  p.ProviderID,
+			Email:       p.Email,
+			DisplayName: p.DisplayName,
+			PhotoURL:    p.PhotoURL,
+		})
+	}
+	if u.Metadata != nil {
+		user.CreatedAt = millis(u.Metadata.CreatedAt)
+		user.LastLoginAt = millis(u.Metadata.LastSignedIn)
+	}
+	return user, nil
+}
+
+// uploadAccount imports the given users, which are all validated before any
+// request is sent.  The users with a password hash require opts.Hash.
+func (h *requestHandler) uploadAccount(ctx context.Context, users []*UserToImport, opts *UserImportOptions) (*UserImportResult, error) {
+	if len(users) > maxImportUsers {
+		return nil, AuthErrMaximumUserCountExceeded
+	}
+	req := &uploadAccountRequest{}
+	hasPassword := false
+	for _, u := range users {
+		if u == nil {
+			return nil, errNullUserProperty
+		}
+		user, err := newUploadAccountUser(u)
+		if err != nil {
+			return nil, err
+		}
+		hasPassword = hasPassword || len(u.PasswordHash) > 0
+		req.Users = append(req.Users, user)
+	}
+	if hasPassword {
+		if opts == nil || opts.Hash == nil {
+			return nil, invalidHashError("a hash algorithm is required to import password hashes")
+		}
+		config, err := opts.Hash.config()
+		if err != nil {
+			return nil, err
+		}
+		req.hashConfig = config
+	}
+	result := &UserImportResult{}
+	if len(users) == 0 {
+		return result, nil
+	}
+
+	resp := new(uploadAccountResponse)
+	if err := h.call(ctx, uploadAccountAPI, req, resp); err != nil {
+		return nil, err
+	}
+	for _, e := range resp.Errors {
+		result.Errors = append(result.Errors, &UserImportErrorInfo{
+			Index:  e.Index,
+			Reason: e.Message,
+		})
+	}
+	result.FailureCount = len(resp.Errors)
+	result.SuccessCount = len(users) - result.FailureCount
+	return result, nil
+}
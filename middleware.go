@@ -0,0 +1,181 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MiddlewareOptions configures the middleware returned by Auth.Middleware.
+type MiddlewareOptions struct {
+	// SessionCookieName is the name of the session cookie verified when the
+	// request has no Authorization header.  If empty, only ID tokens are
+	// accepted.
+	SessionCookieName string
+	// CheckRevoked rejects the revoked tokens and the tokens of disabled
+	// users, at the cost of a request to the Auth API per request.
+	CheckRevoked bool
+	// RequiredClaims are the claims the token must have, e.g. custom claims
+	// set with SetCustomUserClaims.  A nil value only requires the claim to be
+	// present, other values must be equal to the claim as decoded from JSON,
+	// e.g. float64 for numbers.  Requests missing a claim are rejected with 403.
+	RequiredClaims map[string]interface{}
+	// AllowUnauthenticated passes the requests without credentials to the
+	// next handler, without a token in their context.  Requests with invalid
+	// credentials are still rejected.
+	AllowUnauthenticated bool
+}
+
+type tokenContextKey struct{}
+
+// NewContextWithToken returns a copy of ctx carrying the given verified token,
+// which is returned by TokenFromContext.
+func NewContextWithToken(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// TokenFromContext returns the token verified by the middleware returned by
+// Auth.Middleware, if any.
+func TokenFromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(tokenContextKey{}).(*Token)
+	return token, ok
+}
+
+// Middleware returns a middleware verifying the ID token given in the
+// Authorization header as "Bearer <token>", or else the session cookie named
+// by opts.SessionCookieName.  The decoded token is added to the context of
+// the request, see TokenFromContext.
+//
+// Requests without valid credentials are rejected with 401, and requests
+// missing a required claim with 403, both with a JSON body:
+//
+//	{"error":{"code":"id-token-expired","message":"..."}}
+func (a *Auth) Middleware(opts *MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts == nil {
+		opts = &MiddlewareOptions{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := a.verifyRequest(r, opts)
+			if err != nil {
+				writeMiddlewareError(w, err)
+				return
+			}
+			if token == nil {
+				if !opts.AllowUnauthenticated {
+					writeMiddlewareError(w, errMissingCredentials)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := checkRequiredClaims(token, opts.RequiredClaims); err != nil {
+				writeMiddlewareError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContextWithToken(r.Context(), token)))
+		})
+	}
+}
+
+// middlewareError is an error reported by the middleware with the given
+// status and code.
+type middlewareError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *middlewareError) Error() string {
+	return e.message
+}
+
+var errMissingCredentials = &middlewareError{
+	status:  http.StatusUnauthorized,
+	code:    "missing-credentials",
+	message: "the request has no ID token or session cookie",
+}
+
+// verifyRequest verifies the credentials of the request.  It returns a nil
+// token if the request has none.
+func (a *Auth) verifyRequest(r *http.Request, opts *MiddlewareOptions) (*Token, error) {
+	ctx := r.Context()
+	if header := r.Header.Get("Authorization"); header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+			return nil, &middlewareError{
+				status:  http.StatusUnauthorized,
+				code:    "invalid-authorization-header",
+				message: "the Authorization header must be \"Bearer <ID token>\"",
+			}
+		}
+		idToken := strings.TrimSpace(parts[1])
+		if opts.CheckRevoked {
+			return a.VerifyIDTokenAndCheckRevokedWithContext(ctx, idToken)
+		}
+		return a.VerifyIDTokenWithContext(ctx, idToken)
+	}
+	if opts.SessionCookieName == "" {
+		return nil, nil
+	}
+	cookie, err := r.Cookie(opts.SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	if opts.CheckRevoked {
+		return a.VerifySessionCookieAndCheckRevokedWithContext(ctx, cookie.Value)
+	}
+	return a.VerifySessionCookieWithContext(ctx, cookie.Value)
+}
+
+// checkRequiredClaims checks that the token has the required claims.
+func checkRequiredClaims(token *Token, required map[string]interface{}) error {
+	if name, missing := token.MissingClaim(required); missing {
+		return &middlewareError{
+			status:  http.StatusForbidden,
+			code:    "insufficient-claims",
+			message: fmt.Sprintf("the token is missing the required claim %q", name),
+		}
+	}
+	return nil
+}
+
+// writeMiddlewareError writes the JSON response of the given error.  Invalid
+// tokens are reported with 401, and the failures to verify them, e.g. when
+// the public keys cannot be fetched, with 500.
+func writeMiddlewareError(w http.ResponseWriter, err error) {
+	status, message := http.StatusUnauthorized, err.Error()
+	var code string
+	var mErr *middlewareError
+	var tErr *TokenError
+	switch {
+	case errors.As(err, &mErr):
+		status, code = mErr.status, mErr.code
+	case errors.As(err, &tErr):
+		code, message = tErr.Code, tErr.Message
+		if tErr.Is(TokenErrCertificateFetchFailed) || tErr.Is(TokenErrProjectIDMissing) {
+			status = http.StatusInternalServerError
+		}
+	case IsUserNotFound(err):
+		code = "user-not-found"
+	default:
+		status, code = http.StatusInternalServerError, "internal-error"
+	}
+	if status == http.StatusInternalServerError {
+		message = "the credentials could not be verified"
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="firebase"`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
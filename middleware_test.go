@@ -0,0 +1,180 @@
+package firebase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveMiddleware runs the request through the middleware, and returns the
+// response along with the token passed to the next handler.
+func serveMiddleware(auth *Auth, opts *MiddlewareOptions, r *http.Request) (*httptest.ResponseRecorder, *Token) {
+	var token *Token
+	handler := auth.Middleware(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ = TokenFromContext(r.Context())
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, token
+}
+
+func withBearer(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotEmpty(t, body.Error.Message)
+	return body.Error.Code
+}
+
+func TestMiddlewareIDToken(t *testing.T) {
+	auth, signer := newSignedAuth(t, "localhost:0")
+
+	w, token := serveMiddleware(auth, nil, withBearer(signer.idToken(time.Now())))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "myuid", token.UID)
+
+	w, token = serveMiddleware(auth, nil, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "missing-credentials", errorCode(t, w))
+	assert.Equal(t, `Bearer realm="firebase"`, w.Header().Get("WWW-Authenticate"))
+	assert.Nil(t, token)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	w, _ = serveMiddleware(auth, nil, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "invalid-authorization-header", errorCode(t, w))
+
+	expired := signTestToken(t, signer.idKey,
+		map[string]interface{}{"alg": "RS256", "kid": "id"},
+		map[string]interface{}{
+			"iss": idTokenIssuerPrefix + testProjectID,
+			"aud": testProjectID,
+			"iat": time.Now().Add(-2 * time.Hour).Unix(),
+			"exp": time.Now().Add(-time.Hour).Unix(),
+			"sub": "myuid",
+		})
+	w, _ = serveMiddleware(auth, nil, withBearer(expired))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, TokenErrIDTokenExpired.Code, errorCode(t, w))
+
+	w, _ = serveMiddleware(auth, nil, withBearer(signer.sessionCookie(time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, TokenErrInvalidIssuer.Code, errorCode(t, w))
+}
+
+func TestMiddlewareSessionCookie(t *testing.T) {
+	auth, signer := newSignedAuth(t, "localhost:0")
+	opts := &MiddlewareOptions{SessionCookieName: "session"}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: signer.sessionCookie(time.Now())})
+	w, token := serveMiddleware(auth, opts, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "myuid", token.UID)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: signer.idToken(time.Now())})
+	w, _ = serveMiddleware(auth, opts, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "other", Value: signer.sessionCookie(time.Now())})
+	w, _ = serveMiddleware(auth, opts, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "missing-credentials", errorCode(t, w))
+}
+
+func TestMiddlewareAllowUnauthenticated(t *testing.T) {
+	auth, signer := newSignedAuth(t, "localhost:0")
+	opts := &MiddlewareOptions{AllowUnauthenticated: true}
+
+	w, token := serveMiddleware(auth, opts, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, token)
+
+	w, _ = serveMiddleware(auth, opts, withBearer("invalid"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, TokenErrMalformed.Code, errorCode(t, w))
+
+	w, token = serveMiddleware(auth, opts, withBearer(signer.idToken(time.Now())))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "myuid", token.UID)
+}
+
+func TestMiddlewareRequiredClaims(t *testing.T) {
+	auth, signer := newSignedAuth(t, "localhost:0")
+	opts := &MiddlewareOptions{RequiredClaims: map[string]interface{}{
+		"admin": true,
+		"level": nil,
+	}}
+	idToken := func(claims map[string]interface{}) string {
+		payload := map[string]interface{}{
+			"iss": idTokenIssuerPrefix + testProjectID,
+			"aud": testProjectID,
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"sub": "myuid",
+		}
+		for k, v := range claims {
+			payload[k] = v
+		}
+		return signTestToken(t, signer.idKey, map[string]interface{}{"alg": "RS256", "kid": "id"}, payload)
+	}
+
+	w, token := serveMiddleware(auth, opts, withBearer(idToken(map[string]interface{}{"admin": true, "level": 3})))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(3), token.Claims["level"])
+
+	for _, claims := range []map[string]interface{}{
+		{"admin": true},
+		{"admin": false, "level": 3},
+		{"admin": "true", "level": 3},
+	} {
+		w, token = serveMiddleware(auth, opts, withBearer(idToken(claims)))
+		assert.Equal(t, http.StatusForbidden, w.Code, "%v", claims)
+		assert.Equal(t, "insufficient-claims", errorCode(t, w))
+		assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+		assert.Nil(t, token)
+	}
+}
+
+func TestMiddlewareCheckRevoked(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"users":[{"localId":"myuid","disabled":true}]}`))
+	}))
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+	auth.app.options.RetryPolicy = &RetryPolicy{}
+	opts := &MiddlewareOptions{CheckRevoked: true}
+
+	w, _ := serveMiddleware(auth, opts, withBearer(signer.idToken(time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, TokenErrUserDisabled.Code, errorCode(t, w))
+
+	w, _ = serveMiddleware(auth, nil, withBearer(signer.idToken(time.Now())))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	status = http.StatusServiceUnavailable
+	w, _ = serveMiddleware(auth, opts, withBearer(signer.idToken(time.Now())))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "internal-error", errorCode(t, w))
+}
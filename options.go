@@ -1,39 +1,160 @@
 package firebase
 
 import (
-	"errors"
-	"fmt"
+	"net/http"
 	"os"
+	"strings"
 )
 
 // Options is storage for configurable Firebase options.
+//
+// When no credential is set, the credentials are looked up the way
+// Application Default Credentials does: the file named by the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable, then the well-known
+// file written by gcloud, and finally the GCE metadata server.
 type Options struct {
-	// ServiceAccountPath is the path to load the Service Account.
+	// Credential is the credential used to call Google APIs and to sign custom
+	// tokens.  It takes precedence over the Service Account options.
+	Credential Credential
+	// ServiceAccountPath is the path to load the credential JSON file.  Both
+	// service_account and authorized_user files are supported.
 	ServiceAccountPath string
 	// ServiceAccountCredential is the credential for the Service Account.
 	ServiceAccountCredential *GoogleServiceAccountCredential
+	// ProjectID is the Firebase project ID.  If empty, it is taken from the
+	// credential, the GOOGLE_CLOUD_PROJECT environment variable or the
+	// metadata server.
+	ProjectID string
+	// Signer signs custom tokens.  If nil, the credential's private key or the
+	// IAM signBlob API is used.
+	Signer Signer
+	// ServiceAccountEmail is the email of the service account signing custom
+	// tokens through the IAM signBlob API, when the credential holds no
+	// private key.  On GCE it defaults to the instance's service account.
+	ServiceAccountEmail string
+	// IAMEndpoint is the base URL of the IAM Service Account Credentials API
+	// used to sign custom tokens.  If empty, the Google endpoint is used.
+	IAMEndpoint string
+	// AuthEmulatorHost is the host and port of the Firebase Auth Emulator,
+	// e.g. "localhost:9099".  If empty, the FIREBASE_AUTH_EMULATOR_HOST
+	// environment variable is used.  When set, all Auth calls are sent to the
+	// emulator and custom tokens are left unsigned.
+	AuthEmulatorHost string
+	// HTTPClient is the client used for every HTTP request of the SDK: Auth
+	// API calls, OAuth 2.0 token exchanges, IAM signing, metadata server
+	// lookups and public key fetches.  If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// AuthAPIEndpoint is the base URL of the identitytoolkit API.  If empty,
+	// the Google endpoint (or the Auth Emulator) is used.
+	AuthAPIEndpoint string
+	// AuthAPIV1Endpoint is the base URL of the v1 identitytoolkit API, used
+	// for batch operations.  If empty, the Google endpoint (or the Auth
+	// Emulator) is used.
+	AuthAPIV1Endpoint string
+	// TokenURL is the OAuth 2.0 token URL used by service account and refresh
+	// token credentials.  If empty, the Google token URLs are used.
+	TokenURL string
+	// IDTokenCertURL is the URL of the public certificates verifying ID
+	// tokens.  If empty, the Google certificates are used.
+	IDTokenCertURL string
+	// SessionCookieCertURL is the URL of the public keys verifying session
+	// cookies.  If empty, the Google public keys are used.
+	SessionCookieCertURL string
+	// MetadataEndpoint is the base URL of the GCE metadata server.  If empty,
+	// the GCE_METADATA_HOST environment variable or the default metadata
+	// server is used.
+	MetadataEndpoint string
+	// RetryPolicy configures the retries of the failed Auth API calls.  If
+	// nil, DefaultRetryPolicy is used.
+	RetryPolicy *RetryPolicy
 }
 
-// ensureServiceAccount sets the Service Account associated with the Firebase Options.
-func (o *Options) ensureServiceAccount() error {
-	if o.ServiceAccountCredential != nil {
+// ensureCredential sets the Credential associated with the Firebase Options.
+func (o *Options) ensureCredential() error {
+	if o.Credential != nil {
 		// credential already loaded
 		return nil
 	}
-	if o.ServiceAccountPath == "" {
-		return errors.New("ServiceAccountPath cannot be empty.")
+	if o.ServiceAccountCredential != nil {
+		o.Credential = o.ServiceAccountCredential
+		return nil
 	}
-
-	f, err := os.Open(o.ServiceAccountPath)
-	if err != nil {
-		return fmt.Errorf("Service Account file cannot be opened: %s %v", o.ServiceAccountPath, err)
+	if o.ServiceAccountPath == "" {
+		return o.findDefaultCredentials()
 	}
-	defer f.Close()
 
-	c, err := loadCredential(f)
+	c, err := loadCredentialFile(o.ServiceAccountPath)
 	if err != nil {
 		return err
 	}
-	o.ServiceAccountCredential = c
+	o.setCredential(c)
 	return nil
 }
+
+// setCredential sets the loaded credential, keeping ServiceAccountCredential
+// in sync for service accounts.
+func (o *Options) setCredential(c Credential) {
+	o.Credential = c
+	if sa, ok := c.(*GoogleServiceAccountCredential); ok {
+		o.ServiceAccountCredential = sa
+	}
+}
+
+// projectID returns the project ID associated with the Firebase Options.
+func (o *Options) projectID() string {
+	if o.ProjectID != "" {
+		return o.ProjectID
+	}
+	if c := o.ServiceAccountCredential; c != nil && c.ProjectID != "" {
+		return c.ProjectID
+	}
+	if c, ok := o.Credential.(*GoogleServiceAccountCredential); ok && c.ProjectID != "" {
+		return c.ProjectID
+	}
+	return os.Getenv(projectEnvVar)
+}
+
+// httpClient returns the HTTP client to use for all outgoing requests.
+func (o *Options) httpClient() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// retryPolicy returns the retry policy of the Auth API calls.  Zero backoff
+// durations are taken from DefaultRetryPolicy.
+func (o *Options) retryPolicy() *RetryPolicy {
+	if o.RetryPolicy == nil {
+		return DefaultRetryPolicy
+	}
+	p := *o.RetryPolicy
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	return &p
+}
+
+// idTokenCertURL returns the URL of the public certificates of ID tokens.
+func (o *Options) idTokenCertURL() string {
+	if o.IDTokenCertURL != "" {
+		return o.IDTokenCertURL
+	}
+	return idTokenCertURL
+}
+
+// sessionCookieCertURL returns the URL of the public keys of session cookies.
+func (o *Options) sessionCookieCertURL() string {
+	if o.SessionCookieCertURL != "" {
+		return o.SessionCookieCertURL
+	}
+	return sessionCookieCertURL
+}
+
+// withEndpoint returns the given base URL with a trailing slash.
+func withEndpoint(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/"
+}
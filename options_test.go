@@ -1,21 +1,143 @@
 package firebase
 
 import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestEnsureServiceAccount(t *testing.T) {
-	o := &Options{}
-	err := o.ensureServiceAccount()
-	assert.EqualError(t, err, "ServiceAccountPath cannot be empty.")
+func TestEnsureCredential(t *testing.T) {
+	defer setEnv(credentialsEnvVar, "")()
+	defer setEnv("CLOUDSDK_CONFIG", "testdata/nonexistent")()
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	o := &Options{MetadataEndpoint: server.URL}
+	err := o.ensureCredential()
+	assert.Equal(t, errNoDefaultCredentials, err)
 
 	o.ServiceAccountPath = "testdata/service-account-appengine.json"
-	assert.NoError(t, o.ensureServiceAccount())
+	assert.NoError(t, o.ensureCredential())
 	c := o.ServiceAccountCredential
 	assert.NotNil(t, c)
 	assert.Equal(t, "myapp-dev", c.ProjectID)
 	assert.Equal(t, "myapp-dev@appspot.gserviceaccount.com", c.ClientEmail)
 	assert.NotNil(t, c.PrivateKey)
+	assert.Equal(t, "myapp-dev", o.projectID())
+}
+
+// setEnv sets an environment variable (unsetting it for an empty value) and
+// returns a function restoring its previous state.
+func setEnv(key, value string) func() {
+	prev, ok := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// countingTransport counts the requests sent through the HTTP client.
+type countingTransport struct {
+	count int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.count++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOptionsHTTPClientAndEndpoints(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			w.Write([]byte(`{"access_token":"my-access-token","token_type":"Bearer","expires_in":3600}`))
+		case "/certs":
+			w.Header().Set("Cache-Control", "max-age=100")
+			w.Write([]byte(`{}`))
+		default:
+			if r.Header.Get("Authorization") != "Bearer my-access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	o := &Options{
+		ServiceAccountPath: "testdata/service-account-appengine.json",
+		HTTPClient:         &http.Client{Transport: transport},
+		AuthAPIEndpoint:    server.URL + "/identitytoolkit",
+		TokenURL:           server.URL + "/token",
+		IDTokenCertURL:     server.URL + "/certs",
+	}
+	auth := &Auth{app: &App{options: o}}
+	assert.NoError(t, auth.DeleteUser("myuid"))
+	assert.Equal(t, []string{"/token", "/identitytoolkit/deleteAccount"}, paths)
+	assert.Equal(t, 2, transport.count)
+
+	assert.NoError(t, auth.ensureVerifiers(context.Background()))
+	keys, err := auth.idTokenVerifier.keySource.Keys(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Equal(t, "/certs", paths[2])
+	assert.Equal(t, 3, transport.count)
+}
+
+func TestVerifiersCreatedOnce(t *testing.T) {
+	certs, err := ioutil.ReadFile("testdata/public_certs.json")
+	assert.NoError(t, err)
+	transport := &countingTransport{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=100")
+		w.Write(certs)
+	}))
+	defer server.Close()
+
+	o := &Options{
+		ServiceAccountPath:   "testdata/service-account-appengine.json",
+		HTTPClient:           &http.Client{Transport: transport},
+		IDTokenCertURL:       server.URL,
+		SessionCookieCertURL: server.URL,
+	}
+	auth := &Auth{app: &App{options: o}}
+
+	var wg sync.WaitGroup
+	verifiers := make([]*tokenVerifier, 10)
+	for i := range verifiers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, auth.ensureVerifiers(context.Background()))
+			verifiers[i] = auth.idTokenVerifier
+			_, err := auth.cookieVerifier.keySource.Keys(context.Background())
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, v := range verifiers {
+		assert.True(t, v == verifiers[0])
+	}
+	assert.True(t, auth.idTokenVerifier.keySource == auth.cookieVerifier.keySource)
+	_, err = auth.idTokenVerifier.keySource.Keys(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, transport.count)
 }
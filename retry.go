@@ -0,0 +1,95 @@
+package firebase
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy configures how the calls to the identitytoolkit API are retried
+// when they fail with a connection error, a 5xx or a 429 response.
+//
+// The delay before the n-th retry is InitialBackoff * 2^(n-1), capped to
+// MaxBackoff, and randomized by up to Jitter of its value.  A Retry-After
+// header sent by the server takes precedence, and the call is not retried if
+// it asks to wait longer than MaxBackoff.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retries of a call.  Zero disables
+	// the retries.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry.  If zero, the
+	// InitialBackoff of DefaultRetryPolicy is used.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts.  If zero, the
+	// MaxBackoff of DefaultRetryPolicy is used.
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between 0 and 1, by which the delays are
+	// randomized.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the retry policy used when Options.RetryPolicy is nil.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxRetries:     4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.5,
+}
+
+// retrySleep waits for the given delay, or until ctx is done.  It is replaced
+// by a fake clock in tests.
+var retrySleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// backoff returns the delay before the given retry, counting from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(d))
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// isRetryableStatus tells whether a response with the given status code, or a
+// connection error if zero, is worth retrying.
+func isRetryableStatus(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter parses the Retry-After header of resp, given either in seconds or
+// as an HTTP date.  It returns zero if the header is absent or invalid.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(clock.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
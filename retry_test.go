@@ -0,0 +1,203 @@
+package firebase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// fakeSleep replaces retrySleep, recording the delays instead of waiting.
+func fakeSleep() (*[]time.Duration, func()) {
+	var delays []time.Duration
+	orig := retrySleep
+	retrySleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return &delays, func() { retrySleep = orig }
+}
+
+// newRetryServer returns a server failing with the given responses, then
+// succeeding, along with its request counter.
+func newRetryServer(failures ...func(w http.ResponseWriter)) (*httptest.Server, *int) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count <= len(failures) {
+			failures[count-1](w)
+			return
+		}
+		w.Write([]byte(`{"localId":"myuid"}`))
+	}))
+	return server, &count
+}
+
+func failWith(status int, retryAfter string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"message":"INTERNAL_ERROR"}}`))
+	}
+}
+
+func newRetryHandler(endpoint string, policy *RetryPolicy) *requestHandler {
+	return &requestHandler{
+		ts:       oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+		client:   http.DefaultClient,
+		endpoint: endpoint + "/",
+		retry:    policy,
+	}
+}
+
+var testRetryPolicy = &RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     10 * time.Second,
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	delays, restore := fakeSleep()
+	defer restore()
+	server, count := newRetryServer(
+		failWith(http.StatusServiceUnavailable, ""),
+		failWith(http.StatusInternalServerError, ""),
+		failWith(http.StatusBadGateway, ""),
+	)
+	defer server.Close()
+
+	h := newRetryHandler(server.URL, testRetryPolicy)
+	assert.NoError(t, h.deleteAccount(context.Background(), "myuid"))
+	assert.Equal(t, 4, *count)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, *delays)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	delays, restore := fakeSleep()
+	defer restore()
+	server, count := newRetryServer(
+		failWith(http.StatusServiceUnavailable, ""),
+		failWith(http.StatusServiceUnavailable, ""),
+		failWith(http.StatusServiceUnavailable, ""),
+		failWith(http.StatusServiceUnavailable, ""),
+	)
+	defer server.Close()
+
+	h := newRetryHandler(server.URL, testRetryPolicy)
+	assert.Error(t, h.deleteAccount(context.Background(), "myuid"))
+	assert.Equal(t, 4, *count)
+	assert.Len(t, *delays, 3)
+}
+
+func TestRetryNotOnClientErrors(t *testing.T) {
+	_, restore := fakeSleep()
+	defer restore()
+	server, count := newRetryServer(failWith(http.StatusBadRequest, ""))
+	defer server.Close()
+
+	h := newRetryHandler(server.URL, testRetryPolicy)
+	assert.Error(t, h.deleteAccount(context.Background(), "myuid"))
+	assert.Equal(t, 1, *count)
+}
+
+func TestRetryAfter(t *testing.T) {
+	delays, restore := fakeSleep()
+	defer restore()
+	server, count := newRetryServer(
+		failWith(http.StatusTooManyRequests, "3"),
+		failWith(http.StatusServiceUnavailable, "60"),
+	)
+	defer server.Close()
+
+	h := newRetryHandler(server.URL, testRetryPolicy)
+	assert.Error(t, h.deleteAccount(context.Background(), "myuid"))
+	assert.Equal(t, 2, *count)
+	assert.Equal(t, []time.Duration{3 * time.Second}, *delays)
+}
+
+func TestRetryZeroBackoff(t *testing.T) {
+	delays, restore := fakeSleep()
+	defer restore()
+	server, count := newRetryServer(
+		failWith(http.StatusServiceUnavailable, ""),
+		failWith(http.StatusTooManyRequests, "3"),
+	)
+	defer server.Close()
+
+	o := &Options{RetryPolicy: &RetryPolicy{MaxRetries: 3}}
+	h := newRetryHandler(server.URL, o.retryPolicy())
+	assert.NoError(t, h.deleteAccount(context.Background(), "myuid"))
+	assert.Equal(t, 3, *count)
+	assert.Equal(t, []time.Duration{DefaultRetryPolicy.InitialBackoff, 3 * time.Second}, *delays)
+	assert.Equal(t, time.Duration(0), o.RetryPolicy.MaxBackoff)
+}
+
+func TestRetrySignUpNewUser(t *testing.T) {
+	_, restore := fakeSleep()
+	defer restore()
+	server, count := newRetryServer(failWith(http.StatusServiceUnavailable, ""))
+	defer server.Close()
+	h := newRetryHandler(server.URL, testRetryPolicy)
+
+	_, err := h.createNewAccount(context.Background(), (&UserToCreate{}).Email("user@example.com"))
+	assert.Error(t, err)
+	assert.Equal(t, 1, *count)
+
+	*count = 0
+	uid, err := h.createNewAccount(context.Background(), (&UserToCreate{}).UID("myuid"))
+	assert.NoError(t, err)
+	assert.Equal(t, "myuid", uid)
+	assert.Equal(t, 2, *count)
+
+	server2, count2 := newRetryServer(failWith(http.StatusTooManyRequests, ""))
+	defer server2.Close()
+	h = newRetryHandler(server2.URL, testRetryPolicy)
+	_, err = h.createNewAccount(context.Background(), (&UserToCreate{}).Email("user@example.com"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *count2)
+}
+
+func TestRetryConnectionError(t *testing.T) {
+	delays, restore := fakeSleep()
+	defer restore()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	h := newRetryHandler(server.URL, testRetryPolicy)
+	assert.Error(t, h.deleteAccount(context.Background(), "myuid"))
+	assert.Len(t, *delays, 3)
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		assert.True(t, d >= time.Second && d <= 3*time.Second, "backoff(2) = %v", d)
+		assert.True(t, p.backoff(10) <= p.MaxBackoff)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := testClock{}.Now()
+	cases := map[string]time.Duration{
+		"":     0,
+		"5":    5 * time.Second,
+		"-1":   0,
+		"soon": 0,
+		now.Add(30 * time.Second).UTC().Format(http.TimeFormat): 30 * time.Second,
+		now.Add(-time.Hour).UTC().Format(http.TimeFormat):       0,
+	}
+	for v, want := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if v != "" {
+			resp.Header.Set("Retry-After", v)
+		}
+		assert.Equal(t, want, retryAfter(resp), v)
+	}
+}
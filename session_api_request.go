@@ -3,6 +3,17 @@ package firebase
 import (
 	"context"
 	"errors"
+	"time"
+)
+
+const (
+	// defaultSessionCookieDuration is the duration of the session cookies
+	// created without an explicit duration.
+	defaultSessionCookieDuration = 5 * 24 * time.Hour
+	// minSessionCookieDuration is the minimum duration of a session cookie.
+	minSessionCookieDuration = 5 * time.Minute
+	// maxSessionCookieDuration is the maximum duration of a session cookie.
+	maxSessionCookieDuration = 14 * 24 * time.Hour
 )
 
 var (
@@ -10,16 +21,21 @@ var (
 		method:   "POST",
 		endpoint: "createSessionCookie",
 		reqFn: func(src interface{}) error {
-			if r, ok := src.(*getAccountInfoRequest); !ok {
+			if r, ok := src.(*createSessionCookieRequest); !ok {
 				return errIllegalType
-			} else if s1, s2 := len(r.LocalID), len(r.Email); s1 == 0 && s2 == 0 {
-				return errMissingRequestTarget
+			} else if r.IDToken == "" {
+				return AuthErrInvalidIDToken
 			}
 			return nil
 		},
 		respFn: func(src interface{}) error {
-			if _, ok := src.(*getAccountInfoResponse); !ok {
+			if r, ok := src.(*createSessionCookieResponse); !ok {
 				return errIllegalType
+			} else if r.SessionCookie == "" {
+				return &APIError{
+					Code:    AuthErrInternalError.Code,
+					Message: "INTERNAL ASSERT FAILED: Unable to create the session cookie",
+				}
 			}
 			return nil
 		},
@@ -35,71 +51,78 @@ type createSessionCookieResponse struct {
 	SessionCookie string `json:"sessionCookie"`
 }
 
-func (h *requestHandler) createSessionCookie(idToken string, duration int64) (*string, error) {
+// createSessionCookie exchanges the given ID token for a session cookie
+// valid for the given duration, between 5 minutes and 2 weeks.
+func (h *requestHandler) createSessionCookie(ctx context.Context, idToken string, duration time.Duration) (*string, error) {
+	if err := validateSessionCookieParams(idToken, duration); err != nil {
+		return nil, err
+	}
 	req := &createSessionCookieRequest{
 		IDToken:  idToken,
-		Duration: duration,
+		Duration: int64(duration / time.Second),
 	}
 	resp := new(createSessionCookieResponse)
-	if err := h.call(createSessionCookieAPI, req, resp); err != nil {
+	if err := h.call(ctx, createSessionCookieAPI, req, resp); err != nil {
 		return nil, err
 	}
 	return &resp.SessionCookie, nil
 }
 
-// VerifySessionCookieAndCheckRevoked checks if the cookie is valid and has not been revoked
-func (h *requestHandler) verifySessionCookieAndCheckRevoked(projectID string, cookie string) (*UserRecord, error) {
-	token, err := h.verifySessionCookie(projectID, cookie)
-	if err != nil {
-		return nil, err
+func validateSessionCookieParams(idToken string, duration time.Duration) error {
+	if idToken == "" {
+		return AuthErrInvalidIDToken
 	}
+	if duration < minSessionCookieDuration || duration > maxSessionCookieDuration {
+		return AuthErrInvalidSessionCookieDuration
+	}
+	return nil
+}
 
-	valid, err := h.checkRevoked(token)
-
+// verifySessionCookieAndCheckRevoked verifies the cookie and checks that it
+// has not been revoked.
+func (h *requestHandler) verifySessionCookieAndCheckRevoked(ctx context.Context, verifier *tokenVerifier, cookie string) (*Token, error) {
+	token, err := h.verifySessionCookie(ctx, verifier, cookie)
 	if err != nil {
 		return nil, err
 	}
 
-	if !valid {
-		return nil, errors.New("Token has been revoked")
+	if err := h.checkTokenRevoked(ctx, verifier, token); err != nil {
+		return nil, err
 	}
-
-	uid := token.UID
-
-	return h.getAccountByUID(uid)
+	return token, nil
 }
 
-// VerifySessionCookie checks if the cookie is valid
-func (h *requestHandler) verifySessionCookie(projectID string, cookie string) (*Token, error) {
-	verifier, err := newIDTokenVerifier(context.Background(), projectID)
-	if err != nil {
-		return nil, err
-	}
-	return verifier.VerifyToken(context.Background(), cookie)
+// verifySessionCookie checks if the cookie is valid
+func (h *requestHandler) verifySessionCookie(ctx context.Context, verifier *tokenVerifier, cookie string) (*Token, error) {
+	return verifier.VerifyToken(ctx, cookie)
 }
 
-// checkSessionCookieRevoked checks if the given session cookie has been revoked
-func (h *requestHandler) checkSessionCookieRevoked(projectID string, cookie string) (bool, error) {
-	token, err := h.verifySessionCookie(projectID, cookie)
+// checkSessionCookieRevoked verifies the session cookie and tells whether it is
+// still valid, i.e. it has not been revoked and its user is not disabled.
+func (h *requestHandler) checkSessionCookieRevoked(ctx context.Context, verifier *tokenVerifier, cookie string) (bool, error) {
+	token, err := h.verifySessionCookie(ctx, verifier, cookie)
 	if err != nil {
 		return false, err
 	}
-
-	valid, err := h.checkRevoked(token)
-
-	return valid, err
+	err = h.checkTokenRevoked(ctx, verifier, token)
+	if errors.Is(err, TokenErrSessionCookieRevoked) || errors.Is(err, TokenErrUserDisabled) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-// checkRevoked checks if the given session cookie has been revoked
-func (h *requestHandler) checkRevoked(token *Token) (bool, error) {
-	uid := token.UID
-
-	user, err := h.getAccountByUID(uid)
+// checkTokenRevoked returns an error if the user of the verified token is
+// disabled, or if the token was issued before the user's tokens were revoked.
+func (h *requestHandler) checkTokenRevoked(ctx context.Context, verifier *tokenVerifier, token *Token) error {
+	user, err := h.getAccountByUID(ctx, token.UID)
 	if err != nil {
-		return false, err
+		return err
 	}
-
-	iat := token.IssuedAt
-
-	return ((int64)(iat*1000) < user.TokensValidAfterMillis), nil
+	if user.Disabled {
+		return verifier.userDisabledError(token)
+	}
+	if token.IssuedAt*1000 < user.TokensValidAfterMillis {
+		return verifier.revokedTokenError(token)
+	}
+	return nil
 }
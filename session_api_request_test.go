@@ -0,0 +1,222 @@
+package firebase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSigner signs the ID tokens and session cookies accepted by the Auth
+// instances of newSignedAuth.
+type testSigner struct {
+	t         *testing.T
+	idKey     *rsa.PrivateKey
+	cookieKey *rsa.PrivateKey
+}
+
+// newSignedAuth returns an Auth instance calling the given emulator host, but
+// verifying the signatures of tokens against distinct ID token and session
+// cookie keys.
+func newSignedAuth(t *testing.T, host string) (*Auth, *testSigner) {
+	s := &testSigner{t: t}
+	for _, k := range []**rsa.PrivateKey{&s.idKey, &s.cookieKey} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*k = key
+	}
+	auth := newEmulatedAuth(host)
+	if err := auth.ensureVerifiers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	auth.Close()
+	auth.idTokenVerifier.emulated = false
+	auth.idTokenVerifier.keySource = &mockKeySource{keys: []*publicKey{{Kid: "id", Key: &s.idKey.PublicKey}}}
+	auth.cookieVerifier.emulated = false
+	auth.cookieVerifier.keySource = &mockKeySource{keys: []*publicKey{{Kid: "cookie", Key: &s.cookieKey.PublicKey}}}
+	return auth, s
+}
+
+func (s *testSigner) sign(key *rsa.PrivateKey, kid, issuer string, iat time.Time) string {
+	header := map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": kid}
+	payload := map[string]interface{}{
+		"iss": issuer + testProjectID,
+		"aud": testProjectID,
+		"iat": iat.Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"sub": "myuid",
+	}
+	return signTestToken(s.t, key, header, payload)
+}
+
+func (s *testSigner) idToken(iat time.Time) string {
+	return s.sign(s.idKey, "id", idTokenIssuerPrefix, iat)
+}
+
+func (s *testSigner) sessionCookie(iat time.Time) string {
+	return s.sign(s.cookieKey, "cookie", sessionCookieIssuerPrefix, iat)
+}
+
+func TestCreateSessionCookie(t *testing.T) {
+	var requests []createSessionCookieRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/createSessionCookie"))
+		var req createSessionCookieRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+		w.Write([]byte(`{"sessionCookie":"session-cookie"}`))
+	}))
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+	idToken := signer.idToken(time.Now())
+
+	duration := time.Hour
+	cookie, err := auth.CreateSessionCookie(idToken, &duration)
+	assert.NoError(t, err)
+	assert.Equal(t, "session-cookie", *cookie)
+	assert.Equal(t, createSessionCookieRequest{IDToken: idToken, Duration: 3600}, requests[0])
+
+	_, err = auth.CreateSessionCookie(idToken, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5*24*3600), requests[1].Duration)
+
+	for _, d := range []time.Duration{0, 4 * time.Minute, 15 * 24 * time.Hour} {
+		_, err = auth.CreateSessionCookie(idToken, &d)
+		assert.Equal(t, AuthErrInvalidSessionCookieDuration, err, d)
+	}
+	_, err = auth.CreateSessionCookie("", nil)
+	assert.Equal(t, AuthErrInvalidIDToken, err)
+	_, err = auth.CreateSessionCookie(signer.sessionCookie(time.Now()), nil)
+	assert.Error(t, err)
+	assert.Len(t, requests, 2)
+}
+
+func TestVerifySessionCookie(t *testing.T) {
+	auth, signer := newSignedAuth(t, "localhost:0")
+
+	token, err := auth.VerifySessionCookie(signer.sessionCookie(time.Now()))
+	assert.NoError(t, err)
+	assert.Equal(t, "myuid", token.UID)
+	assert.Equal(t, sessionCookieIssuerPrefix+testProjectID, token.Issuer)
+
+	_, err = auth.VerifySessionCookie(signer.idToken(time.Now()))
+	assert.True(t, errors.Is(err, TokenErrInvalidIssuer), "%v", err)
+	_, err = auth.VerifyIDToken(signer.sessionCookie(time.Now()))
+	assert.True(t, errors.Is(err, TokenErrInvalidIssuer), "%v", err)
+}
+
+func TestVerifySessionCookieAndCheckRevoked(t *testing.T) {
+	validSince := time.Now().Add(-time.Hour)
+	disabled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": []map[string]interface{}{{
+				"localId":    "myuid",
+				"disabled":   disabled,
+				"validSince": strconv.FormatInt(validSince.Unix(), 10),
+			}},
+		})
+	}))
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+
+	valid := signer.sessionCookie(time.Now().Add(-time.Minute))
+	token, err := auth.VerifySessionCookieAndCheckRevoked(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, "myuid", token.UID)
+	ok, err := auth.CheckRevoked(valid)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	revoked := signer.sessionCookie(time.Now().Add(-2 * time.Hour))
+	_, err = auth.VerifySessionCookieAndCheckRevoked(revoked)
+	assert.True(t, errors.Is(err, TokenErrSessionCookieRevoked), "%v", err)
+	ok, err = auth.CheckRevoked(revoked)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	disabled = true
+	_, err = auth.VerifySessionCookieAndCheckRevoked(valid)
+	assert.True(t, errors.Is(err, TokenErrUserDisabled), "%v", err)
+	ok, err = auth.CheckRevoked(valid)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = auth.CheckRevoked("invalid")
+	assert.Error(t, err)
+}
+
+func TestCheckRevokedValidSince(t *testing.T) {
+	validSince := time.Unix(time.Now().Add(-time.Hour).Unix(), 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": []map[string]interface{}{{
+				"localId":    "myuid",
+				"validSince": strconv.FormatInt(validSince.Unix(), 10),
+			}},
+		})
+	}))
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+
+	// CheckRevoked reports whether the cookie is still valid, i.e. issued at
+	// or after validSince.
+	cases := []struct {
+		iat   time.Time
+		valid bool
+	}{
+		{validSince.Add(-time.Second), false},
+		{validSince, true},
+		{validSince.Add(time.Second), true},
+	}
+	for _, tc := range cases {
+		valid, err := auth.CheckRevoked(signer.sessionCookie(tc.iat))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.valid, valid, "iat = validSince%+v", tc.iat.Sub(validSince))
+	}
+}
+
+func TestVerifyIDTokenAndCheckRevoked(t *testing.T) {
+	validSince := time.Now().Add(-time.Hour)
+	disabled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": []map[string]interface{}{{
+				"localId":    "myuid",
+				"disabled":   disabled,
+				"validSince": strconv.FormatInt(validSince.Unix(), 10),
+			}},
+		})
+	}))
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+
+	valid := signer.idToken(time.Now().Add(-time.Minute))
+	token, err := auth.VerifyIDTokenAndCheckRevoked(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, "myuid", token.UID)
+
+	revoked := signer.idToken(time.Now().Add(-2 * time.Hour))
+	_, err = auth.VerifyIDTokenAndCheckRevoked(revoked)
+	assert.True(t, errors.Is(err, TokenErrIDTokenRevoked), "%v", err)
+	_, err = auth.VerifyIDToken(revoked)
+	assert.NoError(t, err)
+
+	disabled = true
+	_, err = auth.VerifyIDTokenAndCheckRevoked(valid)
+	assert.True(t, errors.Is(err, TokenErrUserDisabled), "%v", err)
+	assert.False(t, errors.Is(err, TokenErrIDTokenRevoked))
+	_, err = auth.VerifySessionCookieAndCheckRevoked(signer.sessionCookie(time.Now()))
+	assert.True(t, errors.Is(err, TokenErrUserDisabled), "%v", err)
+}
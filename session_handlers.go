@@ -0,0 +1,245 @@
+package firebase
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultSessionCookieName = "session"
+	defaultCSRFCookieName    = "csrfToken"
+	// csrfHeader is the header carrying the CSRF token of requests which do
+	// not post it as a form field.
+	csrfHeader = "X-CSRF-Token"
+	// defaultMaxAuthAge is the default time since the user signed in after
+	// which an ID token can no longer be exchanged for a session cookie.
+	defaultMaxAuthAge = 5 * time.Minute
+)
+
+// SessionOptions configures the handlers returned by Auth.SessionLoginHandler
+// and Auth.SessionLogoutHandler.
+type SessionOptions struct {
+	// CookieName is the name of the session cookie, "session" if empty.
+	CookieName string
+	// CookieDomain and CookiePath scope the session cookie.  The path is "/"
+	// if empty.
+	CookieDomain string
+	CookiePath   string
+	// Duration is the validity of the session cookie, between 5 minutes and
+	// 2 weeks, or 5 days if nil.
+	Duration *time.Duration
+	// MaxAuthAge is the maximum time since the user signed in, as given by the
+	// auth_time claim of the ID token, for the ID token to be exchanged for a
+	// session cookie.  It is 5 minutes if zero.
+	MaxAuthAge time.Duration
+	// SameSite is the SameSite attribute of the cookies, http.SameSiteLaxMode
+	// if zero.
+	SameSite http.SameSite
+	// AllowInsecure sets the cookies without the Secure attribute, e.g. for
+	// local servers without TLS.
+	AllowInsecure bool
+	// CSRFCookieName is the name of the cookie holding the CSRF token,
+	// "csrfToken" if empty.  The requests must also send the token as the
+	// form field of the same name, or the X-CSRF-Token header.
+	CSRFCookieName string
+	// RevokeOnLogout revokes the refresh tokens of the user on logout, which
+	// signs them out of all their sessions and devices.
+	RevokeOnLogout bool
+}
+
+func (o *SessionOptions) cookieName() string {
+	if o.CookieName != "" {
+		return o.CookieName
+	}
+	return defaultSessionCookieName
+}
+
+func (o *SessionOptions) cookiePath() string {
+	if o.CookiePath != "" {
+		return o.CookiePath
+	}
+	return "/"
+}
+
+func (o *SessionOptions) maxAuthAge() time.Duration {
+	if o.MaxAuthAge > 0 {
+		return o.MaxAuthAge
+	}
+	return defaultMaxAuthAge
+}
+
+func (o *SessionOptions) sameSite() http.SameSite {
+	if o.SameSite != 0 {
+		return o.SameSite
+	}
+	return http.SameSiteLaxMode
+}
+
+func (o *SessionOptions) csrfCookieName() string {
+	if o.CSRFCookieName != "" {
+		return o.CSRFCookieName
+	}
+	return defaultCSRFCookieName
+}
+
+// SetCSRFCookie sets a cookie holding a new random CSRF token, and returns the
+// token to be sent back with the login and logout requests, e.g. as a hidden
+// form field.  The cookie is readable by scripts, which may send the token
+// in the X-CSRF-Token header instead.
+func SetCSRFCookie(w http.ResponseWriter, opts *SessionOptions) (string, error) {
+	if opts == nil {
+		opts = &SessionOptions{}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     opts.csrfCookieName(),
+		Value:    token,
+		Domain:   opts.CookieDomain,
+		Path:     opts.cookiePath(),
+		Secure:   !opts.AllowInsecure,
+		SameSite: opts.sameSite(),
+	})
+	return token, nil
+}
+
+// SessionLoginHandler returns a handler exchanging the ID token posted as the
+// "idToken" form field for a session cookie, set as a Secure, HttpOnly and
+// SameSite cookie.  The user must have signed in recently, see
+// SessionOptions.MaxAuthAge, and the request must carry the CSRF token of the
+// cookie set by SetCSRFCookie.  It responds with 204 on success, and the
+// failures are reported like Middleware does.
+func (a *Auth) SessionLoginHandler(opts *SessionOptions) http.Handler {
+	if opts == nil {
+		opts = &SessionOptions{}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkSessionRequest(r, opts); err != nil {
+			writeMiddlewareError(w, err)
+			return
+		}
+		idToken := r.PostFormValue("idToken")
+		if idToken == "" {
+			writeMiddlewareError(w, errMissingIDToken)
+			return
+		}
+		ctx := r.Context()
+		token, err := a.VerifyIDTokenWithContext(ctx, idToken)
+		if err != nil {
+			writeMiddlewareError(w, err)
+			return
+		}
+		authTime := time.Unix(token.AuthTime(), 0)
+		if a.idTokenVerifier.clock.Now().Sub(authTime) > opts.maxAuthAge() {
+			writeMiddlewareError(w, errRecentSignInRequired)
+			return
+		}
+		duration := defaultSessionCookieDuration
+		if opts.Duration != nil {
+			duration = *opts.Duration
+		}
+		cookie, err := a.CreateSessionCookieWithContext(ctx, idToken, &duration)
+		if err != nil {
+			writeMiddlewareError(w, err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     opts.cookieName(),
+			Value:    *cookie,
+			Domain:   opts.CookieDomain,
+			Path:     opts.cookiePath(),
+			MaxAge:   int(duration / time.Second),
+			Secure:   !opts.AllowInsecure,
+			HttpOnly: true,
+			SameSite: opts.sameSite(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SessionLogoutHandler returns a handler clearing the session cookie, and
+// revoking the refresh tokens of its user if opts.RevokeOnLogout is set.  The
+// request must carry the CSRF token like for SessionLoginHandler.  It responds
+// with 204 on success.
+func (a *Auth) SessionLogoutHandler(opts *SessionOptions) http.Handler {
+	if opts == nil {
+		opts = &SessionOptions{}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkSessionRequest(r, opts); err != nil {
+			writeMiddlewareError(w, err)
+			return
+		}
+		if opts.RevokeOnLogout {
+			if c, err := r.Cookie(opts.cookieName()); err == nil && c.Value != "" {
+				ctx := r.Context()
+				// An invalid or expired cookie has no session left to revoke.
+				if token, err := a.VerifySessionCookieWithContext(ctx, c.Value); err == nil {
+					if err := a.RevokeRefreshTokensWithContext(ctx, token.UID); err != nil && !IsUserNotFound(err) {
+						writeMiddlewareError(w, err)
+						return
+					}
+				}
+			}
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     opts.cookieName(),
+			Value:    "",
+			Domain:   opts.CookieDomain,
+			Path:     opts.cookiePath(),
+			MaxAge:   -1,
+			Secure:   !opts.AllowInsecure,
+			HttpOnly: true,
+			SameSite: opts.sameSite(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+var (
+	errMissingIDToken = &middlewareError{
+		status:  http.StatusBadRequest,
+		code:    "missing-id-token",
+		message: "the request has no idToken field",
+	}
+	errRecentSignInRequired = &middlewareError{
+		status:  http.StatusUnauthorized,
+		code:    "recent-sign-in-required",
+		message: "the user must have signed in recently to create a session",
+	}
+	errCSRFTokenMismatch = &middlewareError{
+		status:  http.StatusForbidden,
+		code:    "csrf-token-mismatch",
+		message: "the CSRF token of the request does not match its cookie",
+	}
+)
+
+// checkSessionRequest checks that the request is a POST carrying the CSRF
+// token of its cookie, as a form field or a header.
+func checkSessionRequest(r *http.Request, opts *SessionOptions) error {
+	if r.Method != "POST" {
+		return &middlewareError{
+			status:  http.StatusMethodNotAllowed,
+			code:    "method-not-allowed",
+			message: "the request must be a POST",
+		}
+	}
+	cookie, err := r.Cookie(opts.csrfCookieName())
+	if err != nil || cookie.Value == "" {
+		return errCSRFTokenMismatch
+	}
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(opts.csrfCookieName())
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+		return errCSRFTokenMismatch
+	}
+	return nil
+}
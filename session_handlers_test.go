@@ -0,0 +1,190 @@
+package firebase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSessionServer returns an emulator creating session cookies, and recording
+// the paths of the calls.
+func newSessionServer(paths *[]string, cookie *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*paths = append(*paths, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		switch {
+		case strings.HasSuffix(r.URL.Path, "createSessionCookie"):
+			w.Write([]byte(`{"sessionCookie":"` + *cookie + `"}`))
+		case strings.HasSuffix(r.URL.Path, "/setAccountInfo"):
+			w.Write([]byte(`{"localId":"myuid"}`))
+		default:
+			w.Write([]byte(`{"users":[{"localId":"myuid"}]}`))
+		}
+	}))
+}
+
+// sessionRequest returns a POST of the given form fields, with the CSRF
+// cookie set to csrf if not empty.
+func sessionRequest(form url.Values, csrf string) *http.Request {
+	r := httptest.NewRequest("POST", "/session", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if csrf != "" {
+		r.AddCookie(&http.Cookie{Name: defaultCSRFCookieName, Value: csrf})
+	}
+	return r
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *testSigner) idTokenWithAuthTime(authTime time.Time) string {
+	return signTestToken(s.t, s.idKey,
+		map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": "id"},
+		map[string]interface{}{
+			"iss":       idTokenIssuerPrefix + testProjectID,
+			"aud":       testProjectID,
+			"iat":       time.Now().Unix(),
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"auth_time": authTime.Unix(),
+			"sub":       "myuid",
+		})
+}
+
+func TestSessionLoginHandler(t *testing.T) {
+	var paths []string
+	var sessionCookie string
+	server := newSessionServer(&paths, &sessionCookie)
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+	sessionCookie = signer.sessionCookie(time.Now())
+	duration := time.Hour
+	handler := auth.SessionLoginHandler(&SessionOptions{Duration: &duration})
+
+	w := httptest.NewRecorder()
+	idToken := signer.idTokenWithAuthTime(time.Now())
+	handler.ServeHTTP(w, sessionRequest(url.Values{"idToken": {idToken}, "csrfToken": {"csrf"}}, "csrf"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"createSessionCookie"}, paths)
+	c := responseCookie(w, "session")
+	assert.Equal(t, sessionCookie, c.Value)
+	assert.Equal(t, "/", c.Path)
+	assert.Equal(t, 3600, c.MaxAge)
+	assert.True(t, c.Secure)
+	assert.True(t, c.HttpOnly)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "SameSite=Lax")
+
+	w = httptest.NewRecorder()
+	r := sessionRequest(url.Values{"idToken": {idToken}}, "csrf")
+	r.Header.Set(csrfHeader, "csrf")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	stale := signer.idTokenWithAuthTime(time.Now().Add(-10 * time.Minute))
+	handler.ServeHTTP(w, sessionRequest(url.Values{"idToken": {stale}, "csrfToken": {"csrf"}}, "csrf"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "recent-sign-in-required", errorCode(t, w))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(url.Values{"idToken": {signer.idToken(time.Now())}, "csrfToken": {"csrf"}}, "csrf"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "ID tokens without auth_time")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(url.Values{"csrfToken": {"csrf"}}, "csrf"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "missing-id-token", errorCode(t, w))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(url.Values{"idToken": {"invalid"}, "csrfToken": {"csrf"}}, "csrf"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, responseCookie(w, "session"))
+	assert.Len(t, paths, 2)
+}
+
+func TestSessionHandlersCSRF(t *testing.T) {
+	var paths []string
+	var sessionCookie string
+	server := newSessionServer(&paths, &sessionCookie)
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+	idToken := signer.idTokenWithAuthTime(time.Now())
+
+	for _, handler := range []http.Handler{auth.SessionLoginHandler(nil), auth.SessionLogoutHandler(nil)} {
+		for _, r := range []*http.Request{
+			sessionRequest(url.Values{"idToken": {idToken}}, "csrf"),
+			sessionRequest(url.Values{"idToken": {idToken}, "csrfToken": {"csrf"}}, ""),
+			sessionRequest(url.Values{"idToken": {idToken}, "csrfToken": {"other"}}, "csrf"),
+		} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Equal(t, "csrf-token-mismatch", errorCode(t, w))
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/session?csrfToken=csrf", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	}
+	assert.Empty(t, paths)
+}
+
+func TestSetCSRFCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	token, err := SetCSRFCookie(w, &SessionOptions{CSRFCookieName: "xsrf", AllowInsecure: true})
+	assert.NoError(t, err)
+	assert.Len(t, token, 43)
+	c := responseCookie(w, "xsrf")
+	assert.Equal(t, token, c.Value)
+	assert.False(t, c.HttpOnly)
+	assert.False(t, c.Secure)
+
+	other, err := SetCSRFCookie(httptest.NewRecorder(), nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestSessionLogoutHandler(t *testing.T) {
+	var paths []string
+	var sessionCookie string
+	server := newSessionServer(&paths, &sessionCookie)
+	defer server.Close()
+	auth, signer := newSignedAuth(t, strings.TrimPrefix(server.URL, "http://"))
+
+	logout := func(opts *SessionOptions, cookie string) *httptest.ResponseRecorder {
+		r := sessionRequest(url.Values{"csrfToken": {"csrf"}}, "csrf")
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		auth.SessionLogoutHandler(opts).ServeHTTP(w, r)
+		return w
+	}
+
+	w := logout(nil, signer.sessionCookie(time.Now()))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	c := responseCookie(w, "session")
+	assert.Empty(t, c.Value)
+	assert.Equal(t, -1, c.MaxAge)
+	assert.Empty(t, paths)
+
+	w = logout(&SessionOptions{RevokeOnLogout: true}, signer.sessionCookie(time.Now()))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"getAccountInfo", "setAccountInfo", "getAccountInfo"}, paths)
+
+	w = logout(&SessionOptions{RevokeOnLogout: true}, "invalid")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, -1, responseCookie(w, "session").MaxAge)
+	w = logout(&SessionOptions{RevokeOnLogout: true}, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Len(t, paths, 3)
+}
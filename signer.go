@@ -0,0 +1,156 @@
+package firebase
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/SermoDigital/jose/crypto"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultIAMEndpoint is the base URL of the IAM Service Account Credentials API.
+	defaultIAMEndpoint = "https://iamcredentials.googleapis.com/v1/"
+)
+
+// Signer signs custom tokens on behalf of a service account.
+//
+// Implementations backed by a key management system or an HSM can be set in
+// Options.Signer to mint custom tokens without exposing the private key.
+type Signer interface {
+	// Email returns the email of the service account the tokens are issued by.
+	Email() string
+	// Sign returns the RS256 (RSASSA-PKCS1-v1_5 using SHA-256) signature of
+	// the given data.
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// rsaSigner signs data in-process with an RSA private key.
+type rsaSigner struct {
+	email string
+	key   *rsa.PrivateKey
+}
+
+// NewRSASigner returns a Signer signing in-process with the given RSA private
+// key on behalf of the service account with the given email.
+func NewRSASigner(email string, key *rsa.PrivateKey) Signer {
+	return &rsaSigner{email: email, key: key}
+}
+
+func (s *rsaSigner) Email() string {
+	return s.email
+}
+
+func (s *rsaSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	if s.key == nil {
+		return nil, errors.New("no private key available for signing")
+	}
+	h := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, stdcrypto.SHA256, h[:])
+}
+
+// iamSigner signs data remotely with the signBlob method of the IAM Service
+// Account Credentials API, so that no private key is needed in-process.  The
+// caller's credential must be granted the Service Account Token Creator role
+// on the signing service account.
+type iamSigner struct {
+	email    string
+	endpoint string
+	ts       oauth2.TokenSource
+	client   *http.Client
+}
+
+func newIAMSigner(email, endpoint string, ts oauth2.TokenSource, client *http.Client) *iamSigner {
+	if endpoint == "" {
+		endpoint = defaultIAMEndpoint
+	}
+	return &iamSigner{
+		email:    email,
+		endpoint: withEndpoint(endpoint),
+		ts:       ts,
+		client:   client,
+	}
+}
+
+func (s *iamSigner) Email() string {
+	return s.email
+}
+
+func (s *iamSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{
+		"payload": base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%sprojects/-/serviceAccounts/%s:signBlob", s.endpoint, url.PathEscape(s.email))
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(req)
+
+	resp, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signBlob failed for %s (%d): %s", s.email, resp.StatusCode, string(respBody))
+	}
+	var res struct {
+		SignedBlob string `json:"signedBlob"`
+	}
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(res.SignedBlob)
+}
+
+// signingMethod adapts a Signer to the crypto.SigningMethod used by the jose
+// library to serialize tokens.
+type signingMethod struct {
+	ctx    context.Context
+	signer Signer
+}
+
+func (m *signingMethod) Alg() string {
+	return crypto.SigningMethodRS256.Alg()
+}
+
+func (m *signingMethod) Verify(raw []byte, sig crypto.Signature, key interface{}) error {
+	return errors.New("signingMethod cannot verify signatures")
+}
+
+func (m *signingMethod) Sign(raw []byte, key interface{}) (crypto.Signature, error) {
+	sig, err := m.signer.Sign(m.ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Signature(sig), nil
+}
+
+func (m *signingMethod) Hasher() stdcrypto.Hash {
+	return crypto.SigningMethodRS256.Hasher()
+}
@@ -0,0 +1,128 @@
+package firebase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestIAMSigner(t *testing.T) {
+	f, _ := os.Open("testdata/service-account-appengine.json")
+	defer f.Close()
+	c, _ := loadCredential(f)
+	local := c.Signer()
+
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		var req struct {
+			Payload string `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payload, _ := base64.StdEncoding.DecodeString(req.Payload)
+		sig, _ := local.Sign(r.Context(), payload)
+		json.NewEncoder(w).Encode(map[string]string{
+			"keyId":      "key-id",
+			"signedBlob": base64.StdEncoding.EncodeToString(sig),
+		})
+	}))
+	defer server.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "my-access-token"})
+	s := newIAMSigner(c.ClientEmail, server.URL, ts, http.DefaultClient)
+	assert.Equal(t, c.ClientEmail, s.Email())
+
+	developerClaims := make(Claims)
+	developerClaims["premium_account"] = true
+	token, err := createSignedCustomAuthTokenForUser(context.Background(), "myuid", &developerClaims, s)
+	assert.NoError(t, err)
+	b, _ := ioutil.ReadFile("testdata/token_myuid_golden.txt")
+	assert.Equal(t, strings.TrimSpace(string(b)), token)
+	assert.Equal(t, "/projects/-/serviceAccounts/"+c.ClientEmail+":signBlob", gotPath)
+	assert.Equal(t, "Bearer my-access-token", gotAuth)
+}
+
+func TestIAMSignerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"message": "permission denied"}}`))
+	}))
+	defer server.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "my-access-token"})
+	s := newIAMSigner("sa@myapp-dev.iam.gserviceaccount.com", server.URL+"/", ts, http.DefaultClient)
+	_, err := s.Sign(context.Background(), []byte("data"))
+	assert.Error(t, err)
+}
+
+func TestEnsureSignerRequiresEmail(t *testing.T) {
+	o := &Options{Credential: &AccessTokenCredential{AccessToken: "my-access-token"}}
+	auth := &Auth{app: &App{options: o}}
+	assert.Error(t, auth.ensureSigner())
+
+	o.ServiceAccountEmail = "sa@myapp-dev.iam.gserviceaccount.com"
+	assert.NoError(t, auth.ensureSigner())
+	assert.IsType(t, &iamSigner{}, auth.signer)
+	assert.Equal(t, o.ServiceAccountEmail, auth.signer.Email())
+}
+
+// mockSigner is a Signer standing in for a key management system.
+type mockSigner struct {
+	email string
+	calls int
+}
+
+func (s *mockSigner) Email() string {
+	return s.email
+}
+
+func (s *mockSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	s.calls++
+	return []byte("signature"), nil
+}
+
+func TestOptionsSigner(t *testing.T) {
+	s := &mockSigner{email: "kms@myapp-dev.iam.gserviceaccount.com"}
+	// No credential is looked up when only the Signer is given.
+	defer setEnv(credentialsEnvVar, "testdata/missing.json")()
+	o := &Options{Signer: s}
+	auth := &Auth{app: &App{options: o}}
+	token, err := auth.CreateCustomToken("myuid", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.calls)
+
+	segments := strings.Split(token, ".")
+	assert.Len(t, segments, 3)
+	var payload Token
+	assert.NoError(t, decode(segments[1], &payload))
+	assert.Equal(t, s.email, payload.Issuer)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString([]byte("signature")), segments[2])
+	assert.Nil(t, o.Credential)
+	assert.Nil(t, auth.ts)
+}
+
+func TestRSASigner(t *testing.T) {
+	f, _ := os.Open("testdata/service-account-appengine.json")
+	defer f.Close()
+	c, _ := loadCredential(f)
+
+	s := NewRSASigner(c.ClientEmail, c.PrivateKey)
+	assert.Equal(t, c.ClientEmail, s.Email())
+	token, err := createSignedCustomAuthTokenForUser(context.Background(), "myuid", &Claims{"premium_account": true}, s)
+	assert.NoError(t, err)
+	b, _ := ioutil.ReadFile("testdata/token_myuid_golden.txt")
+	assert.Equal(t, strings.TrimSpace(string(b)), token)
+}
@@ -1,5 +1,7 @@
 package firebase
 
+import "reflect"
+
 // Token represents a decoded Firebase ID token.
 //
 // Token provides typed accessors to the common JWT fields such as Audience (aud) and Expiry (exp).
@@ -15,10 +17,14 @@ type Token struct {
 	Claims   map[string]interface{} `json:"-"`
 }
 
-// IssuedAt returns the time this token was issued
+// AuthTime returns the time the user signed in, in seconds since the epoch.
 func (t *Token) AuthTime() int64 {
-	if res, ok := (t.Claims["auth_time"]).(int64); ok {
+	switch res := t.Claims["auth_time"].(type) {
+	case int64:
 		return res
+	case float64:
+		// Claims decoded from JSON hold numbers as float64.
+		return int64(res)
 	}
 	return int64(0)
 }
@@ -56,6 +62,19 @@ func (t *Token) IsEmailVerified() bool {
 	return false
 }
 
+// MissingClaim returns the name of a required claim the token lacks, and false
+// if the token has them all.  A claim required with a nil value only has to be
+// present, others must be equal to the required value.
+func (t *Token) MissingClaim(required map[string]interface{}) (string, bool) {
+	for name, want := range required {
+		got, ok := t.Claims[name]
+		if !ok || (want != nil && !reflect.DeepEqual(got, want)) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 // Claims returns all of the claims on this token.
 func (t *Token) GetClaims() Claims {
 	return Claims(t.Claims)
@@ -1,7 +1,6 @@
 package firebase
 
 import (
-	"crypto/rsa"
 	"errors"
 	"fmt"
 	"sort"
@@ -9,6 +8,7 @@ import (
 
 	"github.com/SermoDigital/jose/crypto"
 	"github.com/SermoDigital/jose/jws"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -41,7 +41,9 @@ func init() {
 }
 
 // createSignedCustomAuthTokenForUser creates a custom auth token for a given user.
-func createSignedCustomAuthTokenForUser(uid string, developerClaims *Claims, issuer string, privateKey *rsa.PrivateKey) (string, error) {
+// The token is issued by the signer's service account and signed by it.
+func createSignedCustomAuthTokenForUser(ctx context.Context, uid string, developerClaims *Claims, signer Signer) (string, error) {
+	issuer := signer.Email()
 	if uid == "" {
 		return "", errors.New("Uid must be provided.")
 	}
@@ -52,7 +54,10 @@ func createSignedCustomAuthTokenForUser(uid string, developerClaims *Claims, iss
 		return "", errors.New("Uid must be shorter than 128 characters")
 	}
 
-	method := crypto.SigningMethodRS256
+	var method crypto.SigningMethod = &signingMethod{ctx: ctx, signer: signer}
+	if _, ok := signer.(emulatorSigner); ok {
+		method = crypto.Unsecured
+	}
 	claims := jws.Claims{}
 	claims.Set("uid", uid)
 	claims.SetIssuer(issuer)
@@ -72,7 +77,7 @@ func createSignedCustomAuthTokenForUser(uid string, developerClaims *Claims, iss
 	}
 
 	jwt := jws.NewJWT(claims, method)
-	bytes, err := jwt.Serialize(privateKey)
+	bytes, err := jwt.Serialize(signer)
 	if err != nil {
 		return "", err
 	}
@@ -1,6 +1,7 @@
 package firebase
 
 import (
+	"context"
 	"flag"
 	"io/ioutil"
 	"os"
@@ -30,22 +31,24 @@ func TestCreateCustomAuthTokenForUser(t *testing.T) {
 	f, _ := os.Open("testdata/service-account-appengine.json")
 	defer f.Close()
 	c, _ := loadCredential(f)
+	ctx := context.Background()
+	s := c.Signer()
 
-	_, err := createSignedCustomAuthTokenForUser("", nil, c.ClientEmail, c.PrivateKey)
+	_, err := createSignedCustomAuthTokenForUser(ctx, "", nil, s)
 	assert.EqualError(t, err, "Uid must be provided.")
-	_, err = createSignedCustomAuthTokenForUser("myuid", nil, "", c.PrivateKey)
+	_, err = createSignedCustomAuthTokenForUser(ctx, "myuid", nil, &rsaSigner{key: c.PrivateKey})
 	assert.EqualError(t, err, "Must provide an issuer.")
 
 	developerClaims := make(Claims)
 	developerClaims["aud"] = "reserved"
-	_, err = createSignedCustomAuthTokenForUser("myuid", &developerClaims, c.ClientEmail, c.PrivateKey)
+	_, err = createSignedCustomAuthTokenForUser(ctx, "myuid", &developerClaims, s)
 	assert.EqualError(t, err, "developer_claims cannot contain a reserved key: aud")
 
 	b, _ := ioutil.ReadFile("testdata/token_myuid_golden.txt")
 	expected := strings.TrimSpace(string(b))
 	developerClaims = make(Claims)
 	developerClaims["premium_account"] = true
-	token, err := createSignedCustomAuthTokenForUser("myuid", &developerClaims, c.ClientEmail, c.PrivateKey)
+	token, err := createSignedCustomAuthTokenForUser(ctx, "myuid", &developerClaims, s)
 	assert.NoError(t, err)
 	assert.Equal(t, expected, token)
 }
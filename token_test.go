@@ -93,3 +93,43 @@ func TestTokenEmptyClaims(t *testing.T) {
 		t.Errorf("token.isEmailVerified = %v; want = %v", token.IsEmailVerified(), false)
 	}
 }
+
+func TestTokenAuthTimeFromJSON(t *testing.T) {
+	token := &Token{
+		Claims: map[string]interface{}{
+			"auth_time": float64(1500000000),
+		},
+	}
+
+	if token.AuthTime() != 1500000000 {
+		t.Errorf("token.authTime = %v; want = %v", token.AuthTime(), 1500000000)
+	}
+}
+
+func TestTokenMissingClaim(t *testing.T) {
+	token := &Token{
+		Claims: map[string]interface{}{
+			"admin": true,
+			"roles": []interface{}{"editor"},
+		},
+	}
+
+	cases := []struct {
+		required map[string]interface{}
+		name     string
+		missing  bool
+	}{
+		{nil, "", false},
+		{map[string]interface{}{"admin": nil}, "", false},
+		{map[string]interface{}{"admin": true, "roles": []interface{}{"editor"}}, "", false},
+		{map[string]interface{}{"admin": false}, "admin", true},
+		{map[string]interface{}{"roles": []interface{}{"owner"}}, "roles", true},
+		{map[string]interface{}{"premium": nil}, "premium", true},
+	}
+	for _, tc := range cases {
+		name, missing := token.MissingClaim(tc.required)
+		if name != tc.name || missing != tc.missing {
+			t.Errorf("MissingClaim(%v) = (%q, %v); want = (%q, %v)", tc.required, name, missing, tc.name, tc.missing)
+		}
+	}
+}
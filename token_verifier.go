@@ -33,6 +33,7 @@ import (
 	"sync"
 	"time"
 
+	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	"google.golang.org/api/transport"
 )
@@ -90,6 +91,13 @@ type tokenVerifier struct {
 	issuerPrefix      string
 	keySource         keySource
 	clock             Clock
+	// expiredError and revokedError are the kinds of the errors reporting
+	// expired and revoked tokens.
+	expiredError *TokenError
+	revokedError *TokenError
+	// emulated disables the signature checks for the unsigned tokens issued
+	// by the Auth Emulator.
+	emulated bool
 }
 
 func newIDTokenVerifier(ctx context.Context, projectID string) (*tokenVerifier, error) {
@@ -105,6 +113,8 @@ func newIDTokenVerifier(ctx context.Context, projectID string) (*tokenVerifier,
 		issuerPrefix:      idTokenIssuerPrefix,
 		keySource:         newHTTPKeySource(idTokenCertURL, noAuthHTTPClient),
 		clock:             SystemClock,
+		expiredError:      TokenErrIDTokenExpired,
+		revokedError:      TokenErrIDTokenRevoked,
 	}, nil
 }
 
@@ -121,6 +131,8 @@ func newSessionCookieVerifier(ctx context.Context, projectID string) (*tokenVeri
 		issuerPrefix:      sessionCookieIssuerPrefix,
 		keySource:         newHTTPKeySource(sessionCookieCertURL, noAuthHTTPClient),
 		clock:             SystemClock,
+		expiredError:      TokenErrSessionCookieExpired,
+		revokedError:      TokenErrSessionCookieRevoked,
 	}, nil
 }
 
@@ -135,27 +147,38 @@ func newSessionCookieVerifier(ctx context.Context, projectID string) (*tokenVeri
 //   - The JWT is not expired, and it has been issued some time in the past.
 //   - The JWT is signed by a Firebase Auth backend server as determined by the keySource.
 //
-// If any of the above conditions are not met, an error is returned. Otherwise a pointer to a
-// decoded Token is returned.
+// If any of the above conditions are not met, a *TokenError is returned. Otherwise a pointer
+// to a decoded Token is returned.
 func (tv *tokenVerifier) VerifyToken(ctx context.Context, token string) (*Token, error) {
 	if tv.projectID == "" {
-		return nil, errors.New("project id not available")
+		return nil, &TokenError{
+			Code:    TokenErrProjectIDMissing.Code,
+			Message: "project id not available",
+		}
 	}
 	if token == "" {
-		return nil, fmt.Errorf("%s must be a non-empty string", tv.shortName)
+		return nil, &TokenError{
+			Code:    TokenErrMalformed.Code,
+			Message: fmt.Sprintf("%s must be a non-empty string", tv.shortName),
+		}
 	}
 
 	// Validate the token content first. This is fast and cheap.
 	payload, err := tv.verifyContent(token)
 	if err != nil {
-		return nil, fmt.Errorf("%s; see %s for details on how to retrieve a valid %s",
-			err.Error(), tv.docURL, tv.shortName)
+		err.Message = fmt.Sprintf("%s; see %s for details on how to retrieve a valid %s",
+			err.Message, tv.docURL, tv.shortName)
+		return nil, err
 	}
 
 	if err := tv.verifyTimestamps(payload); err != nil {
 		return nil, err
 	}
 
+	if tv.emulated {
+		return payload, nil
+	}
+
 	// Verifying the signature requires syncronized access to a key cache and
 	// potentially issues an http request. Therefore we do it last.
 	if err := tv.verifySignature(ctx, token); err != nil {
@@ -164,7 +187,7 @@ func (tv *tokenVerifier) VerifyToken(ctx context.Context, token string) (*Token,
 	return payload, nil
 }
 
-func (tv *tokenVerifier) verifyContent(token string) (*Token, error) {
+func (tv *tokenVerifier) verifyContent(token string) (*Token, *TokenError) {
 	var (
 		header  jwtHeader
 		payload Token
@@ -172,49 +195,92 @@ func (tv *tokenVerifier) verifyContent(token string) (*Token, error) {
 
 	segments := strings.Split(token, ".")
 	if len(segments) != 3 {
-		return nil, errors.New("incorrect number of segments")
+		return nil, &TokenError{
+			Code:    TokenErrMalformed.Code,
+			Message: "incorrect number of segments",
+		}
 	}
 
 	if err := decode(segments[0], &header); err != nil {
-		return nil, err
+		return nil, tv.malformedError(err)
 	}
 
 	if err := decode(segments[1], &payload); err != nil {
-		return nil, err
+		return nil, tv.malformedError(err)
 	}
 
 	issuer := tv.issuerPrefix + tv.projectID
-	if header.KeyID == "" {
-		if payload.Audience == firebaseAudience {
-			return nil, fmt.Errorf("expected %s but got a custom token", tv.articledShortName)
+	if payload.Audience == firebaseAudience && (header.KeyID == "" || tv.emulated) {
+		return nil, &TokenError{
+			Code:    TokenErrMalformed.Code,
+			Message: fmt.Sprintf("expected %s but got a custom token", tv.articledShortName),
+			Claim:   "aud",
+			Value:   payload.Audience,
 		}
-		return nil, fmt.Errorf("%s has no 'kid' header", tv.shortName)
 	}
-	if header.Algorithm != "RS256" {
-		return nil, fmt.Errorf("%s has invalid algorithm; expected 'RS256' but got %q",
-			tv.shortName, header.Algorithm)
+	// The Auth Emulator issues unsigned tokens without a key ID.
+	if !tv.emulated {
+		if header.KeyID == "" {
+			return nil, &TokenError{
+				Code:    TokenErrMissingKeyID.Code,
+				Message: fmt.Sprintf("%s has no 'kid' header", tv.shortName),
+				Claim:   "kid",
+			}
+		}
+		if header.Algorithm != "RS256" {
+			return nil, &TokenError{
+				Code: TokenErrInvalidAlgorithm.Code,
+				Message: fmt.Sprintf("%s has invalid algorithm; expected 'RS256' but got %q",
+					tv.shortName, header.Algorithm),
+				Claim:    "alg",
+				Value:    header.Algorithm,
+				Expected: "RS256",
+			}
+		}
 	}
 	if payload.Audience != tv.projectID {
-		return nil, fmt.Errorf("%s has invalid 'aud' (audience) claim; expected %q but got %q; %s",
-			tv.shortName, tv.projectID, payload.Audience, tv.getProjectIDMatchMessage())
+		return nil, &TokenError{
+			Code: TokenErrInvalidAudience.Code,
+			Message: fmt.Sprintf("%s has invalid 'aud' (audience) claim; expected %q but got %q; %s",
+				tv.shortName, tv.projectID, payload.Audience, tv.getProjectIDMatchMessage()),
+			Claim:    "aud",
+			Value:    payload.Audience,
+			Expected: tv.projectID,
+		}
 	}
 	if payload.Issuer != issuer {
-		return nil, fmt.Errorf("%s has invalid 'iss' (issuer) claim; expected %q but got %q; %s",
-			tv.shortName, issuer, payload.Issuer, tv.getProjectIDMatchMessage())
+		return nil, &TokenError{
+			Code: TokenErrInvalidIssuer.Code,
+			Message: fmt.Sprintf("%s has invalid 'iss' (issuer) claim; expected %q but got %q; %s",
+				tv.shortName, issuer, payload.Issuer, tv.getProjectIDMatchMessage()),
+			Claim:    "iss",
+			Value:    payload.Issuer,
+			Expected: issuer,
+		}
 	}
 	if payload.Subject == "" {
-		return nil, fmt.Errorf("%s has empty 'sub' (subject) claim", tv.shortName)
+		return nil, &TokenError{
+			Code:    TokenErrInvalidSubject.Code,
+			Message: fmt.Sprintf("%s has empty 'sub' (subject) claim", tv.shortName),
+			Claim:   "sub",
+			Value:   payload.Subject,
+		}
 	}
 	if len(payload.Subject) > 128 {
-		return nil, fmt.Errorf("%s has a 'sub' (subject) claim longer than 128 characters",
-			tv.shortName)
+		return nil, &TokenError{
+			Code: TokenErrInvalidSubject.Code,
+			Message: fmt.Sprintf("%s has a 'sub' (subject) claim longer than 128 characters",
+				tv.shortName),
+			Claim: "sub",
+			Value: payload.Subject,
+		}
 	}
 
 	payload.UID = payload.Subject
 
 	var customClaims map[string]interface{}
 	if err := decode(segments[1], &customClaims); err != nil {
-		return nil, err
+		return nil, tv.malformedError(err)
 	}
 	for _, standardClaim := range []string{"iss", "aud", "exp", "iat", "sub", "uid"} {
 		delete(customClaims, standardClaim)
@@ -224,11 +290,30 @@ func (tv *tokenVerifier) verifyContent(token string) (*Token, error) {
 	return &payload, nil
 }
 
+// malformedError returns the error of a token segment that cannot be decoded.
+func (tv *tokenVerifier) malformedError(err error) *TokenError {
+	return &TokenError{
+		Code:    TokenErrMalformed.Code,
+		Message: fmt.Sprintf("%s cannot be decoded", tv.shortName),
+		Err:     err,
+	}
+}
+
 func (tv *tokenVerifier) verifyTimestamps(payload *Token) error {
 	if (int64)(payload.IssuedAt-clockSkewSeconds) > tv.clock.Now().Unix() {
-		return fmt.Errorf("%s issued at future timestamp: %+v", tv.shortName, payload.IssuedAt)
+		return &TokenError{
+			Code:    TokenErrIssuedInFuture.Code,
+			Message: fmt.Sprintf("%s issued at future timestamp: %+v", tv.shortName, payload.IssuedAt),
+			Claim:   "iat",
+			Value:   payload.IssuedAt,
+		}
 	} else if (int64)(payload.Expires+clockSkewSeconds) < tv.clock.Now().Unix() {
-		return fmt.Errorf("%s has expired at: %+v", tv.shortName, payload.Expires)
+		return &TokenError{
+			Code:    tv.expiredError.Code,
+			Message: fmt.Sprintf("%s has expired at: %+v", tv.shortName, payload.Expires),
+			Claim:   "exp",
+			Value:   payload.Expires,
+		}
 	}
 	return nil
 }
@@ -238,12 +323,16 @@ func (tv *tokenVerifier) verifySignature(ctx context.Context, token string) erro
 
 	var h jwtHeader
 	if err := decode(segments[0], &h); err != nil {
-		return err
+		return tv.malformedError(err)
 	}
 
 	keys, err := tv.keySource.Keys(ctx)
 	if err != nil {
-		return err
+		return &TokenError{
+			Code:    TokenErrCertificateFetchFailed.Code,
+			Message: fmt.Sprintf("failed to fetch the public keys verifying the %s", tv.shortName),
+			Err:     err,
+		}
 	}
 
 	verified := false
@@ -256,11 +345,37 @@ func (tv *tokenVerifier) verifySignature(ctx context.Context, token string) erro
 		}
 	}
 	if !verified {
-		return errors.New("failed to verify token signature")
+		return &TokenError{
+			Code:    TokenErrInvalidSignature.Code,
+			Message: "failed to verify token signature",
+			Claim:   "kid",
+			Value:   h.KeyID,
+		}
 	}
 	return nil
 }
 
+// revokedTokenError returns the error of a token issued before the tokens of
+// its user were revoked.
+func (tv *tokenVerifier) revokedTokenError(token *Token) *TokenError {
+	return &TokenError{
+		Code:    tv.revokedError.Code,
+		Message: fmt.Sprintf("%s has been revoked", tv.shortName),
+		Claim:   "iat",
+		Value:   token.IssuedAt,
+	}
+}
+
+// userDisabledError returns the error of a token whose user is disabled.
+func (tv *tokenVerifier) userDisabledError(token *Token) *TokenError {
+	return &TokenError{
+		Code:    TokenErrUserDisabled.Code,
+		Message: fmt.Sprintf("the user of %s is disabled", tv.articledShortName),
+		Claim:   "sub",
+		Value:   token.UID,
+	}
+}
+
 func (tv *tokenVerifier) getProjectIDMatchMessage() string {
 	return fmt.Sprintf(
 		"make sure the %s comes from the same Firebase project as the credential used to"+
@@ -300,16 +415,49 @@ type keySource interface {
 	Keys(context.Context) ([]*publicKey, error)
 }
 
+const (
+	// keyFetchTimeout bounds a fetch of the public keys, which is shared by
+	// all the callers waiting for it and so does not use their contexts.
+	keyFetchTimeout = 30 * time.Second
+	// keyFetchMinBackoff and keyFetchMaxBackoff bound the delay before the
+	// public keys are fetched again after a failure.
+	keyFetchMinBackoff = time.Second
+	keyFetchMaxBackoff = time.Minute
+)
+
 // httpKeySource fetches RSA public keys from a remote HTTP server, and caches them in
 // memory. It also handles cache! invalidation and refresh based on the standard HTTP
 // cache-control headers.
+//
+// Concurrent fetches are collapsed into a single HTTP request, which is made without
+// holding the lock so that readers are served the cached keys meanwhile. Expired keys
+// are still served while a fetch is in flight, or when it fails, and failed fetches
+// are retried with an exponential backoff. Once started, a background refresher
+// fetches the keys ahead of their expiry until Close is called. The refresher stops
+// once the keys are fetched with an HTTP client given by a caller, which may only be
+// usable within the caller's request, e.g. the urlfetch transport of App Engine.
 type httpKeySource struct {
-	KeyURI     string
-	HTTPClient *http.Client
-	CachedKeys []*publicKey
-	ExpiryTime time.Time
-	Clock      Clock
-	Mutex      *sync.Mutex
+	KeyURI      string
+	HTTPClient  *http.Client
+	CachedKeys  []*publicKey
+	ExpiryTime  time.Time
+	RefreshTime time.Time
+	Clock       Clock
+	Mutex       *sync.RWMutex
+
+	// fetching is the fetch in flight, nil if there is none.
+	fetching  *keyFetch
+	err       error
+	failures  int
+	retryTime time.Time
+
+	// refresher is set when the background refresher is to be started after
+	// the first successful fetch, and cleared once a caller's HTTP client is
+	// used.
+	refresher bool
+	started   bool
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func newHTTPKeySource(uri string, hc *http.Client) *httpKeySource {
@@ -317,61 +465,218 @@ func newHTTPKeySource(uri string, hc *http.Client) *httpKeySource {
 		KeyURI:     uri,
 		HTTPClient: hc,
 		Clock:      SystemClock,
-		Mutex:      &sync.Mutex{},
+		Mutex:      &sync.RWMutex{},
+		closed:     make(chan struct{}),
 	}
 }
 
 // Keys returns the RSA Public Keys hosted at this key source's URI. Refreshes the data if
-// the cache is stale.
+// the cache is stale, using the HTTP client set in ctx under the oauth2.HTTPClient key if any.
 func (k *httpKeySource) Keys(ctx context.Context) ([]*publicKey, error) {
+	k.Mutex.RLock()
+	keys := k.CachedKeys
+	now := k.Clock.Now()
+	expired := now.After(k.ExpiryTime)
+	backingOff := k.err != nil && now.Before(k.retryTime)
+	fetching := k.fetching != nil
+	lastErr := k.err
+	k.Mutex.RUnlock()
+
+	if len(keys) > 0 && (!expired || fetching || backingOff) {
+		return keys, nil
+	}
+	if len(keys) == 0 && backingOff && !fetching {
+		return nil, lastErr
+	}
+	if err := k.refresh(ctx); err != nil {
+		if len(keys) > 0 {
+			return keys, nil
+		}
+		return nil, err
+	}
+	k.Mutex.RLock()
+	defer k.Mutex.RUnlock()
+	return k.CachedKeys, nil
+}
+
+// startRefresher makes the key source refresh its keys in the background, ahead of
+// their expiry, once they have been fetched for the first time.
+func (k *httpKeySource) startRefresher() {
 	k.Mutex.Lock()
 	defer k.Mutex.Unlock()
-	if len(k.CachedKeys) == 0 || k.hasExpired() {
-		err := k.refreshKeys(ctx)
-		if err != nil && len(k.CachedKeys) == 0 {
-			return nil, err
+	k.refresher = true
+	if len(k.CachedKeys) > 0 {
+		k.startRefresherLocked()
+	}
+}
+
+func (k *httpKeySource) startRefresherLocked() {
+	if !k.refresher || k.started {
+		return
+	}
+	select {
+	case <-k.closed:
+		return
+	default:
+	}
+	k.started = true
+	go k.refreshLoop()
+}
+
+// Close stops the background refresher. The key source can still be used, fetching
+// the keys on demand.
+func (k *httpKeySource) Close() error {
+	k.closeOnce.Do(func() {
+		close(k.closed)
+	})
+	return nil
+}
+
+func (k *httpKeySource) refreshLoop() {
+	for {
+		k.Mutex.Lock()
+		if !k.refresher {
+			k.started = false
+			k.Mutex.Unlock()
+			return
 		}
+		next := k.RefreshTime
+		if k.err != nil && k.retryTime.After(next) {
+			next = k.retryTime
+		}
+		wait := next.Sub(k.Clock.Now())
+		k.Mutex.Unlock()
+		if wait < keyFetchMinBackoff {
+			wait = keyFetchMinBackoff
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-k.closed:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		k.refresh(context.Background())
+	}
+}
+
+// keyFetch is a fetch of the public keys, shared by the callers of refresh.
+type keyFetch struct {
+	// done is closed when the fetch completes.
+	done chan struct{}
+	err  error
+}
+
+// refresh fetches the keys, or waits for the fetch already in flight.  The
+// fetch runs on its own context, so that a caller giving up on ctx neither
+// fails the fetch for the other callers nor triggers the backoff.
+func (k *httpKeySource) refresh(ctx context.Context) error {
+	k.Mutex.Lock()
+	f := k.fetching
+	if f == nil {
+		f = &keyFetch{done: make(chan struct{})}
+		k.fetching = f
+		go k.fetch(fetchContext(ctx), f)
+	}
+	k.Mutex.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return k.CachedKeys, nil
 }
 
-// hasExpired indicates whether the cache has expired.
-func (k *httpKeySource) hasExpired() bool {
-	return k.Clock.Now().After(k.ExpiryTime)
+// fetchContext returns a context detached from ctx, keeping only the HTTP
+// client set under the oauth2.HTTPClient key.
+func fetchContext(ctx context.Context) context.Context {
+	fetchCtx := context.Background()
+	if hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && hc != nil {
+		fetchCtx = context.WithValue(fetchCtx, oauth2.HTTPClient, hc)
+	}
+	return fetchCtx
 }
 
-func (k *httpKeySource) refreshKeys(ctx context.Context) error {
-	k.CachedKeys = nil
+func (k *httpKeySource) fetch(ctx context.Context, f *keyFetch) {
+	ctx, cancel := context.WithTimeout(ctx, keyFetchTimeout)
+	defer cancel()
+	keys, maxAge, err := k.fetchKeys(ctx)
+
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+	now := k.Clock.Now()
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// An interrupted fetch says nothing about the key server, and is
+		// retried by the next caller.
+	case err != nil:
+		k.failures++
+		k.err = err
+		k.retryTime = now.Add(keyFetchBackoff(k.failures))
+	default:
+		if _, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+			k.refresher = false
+		}
+		k.CachedKeys = keys
+		k.ExpiryTime = now.Add(maxAge)
+		k.RefreshTime = now.Add(maxAge - maxAge/10)
+		k.failures = 0
+		k.err = nil
+		k.startRefresherLocked()
+	}
+	f.err = err
+	k.fetching = nil
+	close(f.done)
+}
+
+// keyFetchBackoff returns the delay before fetching the keys again after the given
+// number of consecutive failures.
+func keyFetchBackoff(failures int) time.Duration {
+	d := keyFetchMinBackoff
+	for i := 1; i < failures && d < keyFetchMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > keyFetchMaxBackoff {
+		d = keyFetchMaxBackoff
+	}
+	return d
+}
+
+func (k *httpKeySource) fetchKeys(ctx context.Context) ([]*publicKey, time.Duration, error) {
 	req, err := http.NewRequest("GET", k.KeyURI, nil)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	resp, err := k.HTTPClient.Do(req.WithContext(ctx))
+	hc := k.HTTPClient
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c != nil {
+		hc = c
+	}
+	resp, err := hc.Do(req.WithContext(ctx))
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
 	contents, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid response (%d) while retrieving public keys: %s",
+		return nil, 0, fmt.Errorf("invalid response (%d) while retrieving public keys: %s",
 			resp.StatusCode, string(contents))
 	}
 	newKeys, err := parsePublicKeys(contents)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	maxAge, err := findMaxAge(resp)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	k.CachedKeys = append([]*publicKey(nil), newKeys...)
-	k.ExpiryTime = k.Clock.Now().Add(*maxAge)
-	return nil
+	return newKeys, *maxAge, nil
 }
 
 func parsePublicKeys(keys []byte) ([]*publicKey, error) {
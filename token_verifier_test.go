@@ -15,14 +15,24 @@
 package firebase
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
+
+	"golang.org/x/oauth2"
 )
 
 const (
@@ -135,6 +145,361 @@ func TestHTTPKeySourceTransportError(t *testing.T) {
 	}
 }
 
+// mockKeySource serves fixed public keys, or fails with err.
+type mockKeySource struct {
+	keys []*publicKey
+	err  error
+}
+
+func (m *mockKeySource) Keys(context.Context) ([]*publicKey, error) {
+	return m.keys, m.err
+}
+
+// signTestToken returns a JWT with the given header and payload, signed with key.
+func signTestToken(t *testing.T, key *rsa.PrivateKey, header, payload map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	content := encode(header) + "." + encode(payload)
+	h := sha256.Sum256([]byte(content))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyTokenErrors(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	tv, err := newIDTokenVerifier(context.Background(), testProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tv.clock = &MockClock{Timestamp: now}
+	tv.keySource = &mockKeySource{keys: []*publicKey{{Kid: "kid1", Key: &key.PublicKey}}}
+
+	header := func() map[string]interface{} {
+		return map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": "kid1"}
+	}
+	payload := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": idTokenIssuerPrefix + testProjectID,
+			"aud": testProjectID,
+			"iat": now.Unix() - 100,
+			"exp": now.Unix() + 3600,
+			"sub": "myuid",
+		}
+	}
+	with := func(m map[string]interface{}, k string, v interface{}) map[string]interface{} {
+		if v == nil {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+		return m
+	}
+
+	valid := signTestToken(t, key, header(), payload())
+	if token, err := tv.VerifyToken(context.Background(), valid); err != nil || token.UID != "myuid" {
+		t.Fatalf("VerifyToken() = (%v, %v); want = (myuid, nil)", token, err)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  *TokenError
+		claim string
+		value interface{}
+	}{
+		{"empty", "", TokenErrMalformed, "", nil},
+		{"segments", "a.b", TokenErrMalformed, "", nil},
+		{"no kid", signTestToken(t, key, with(header(), "kid", nil), payload()), TokenErrMissingKeyID, "kid", nil},
+		{"algorithm", signTestToken(t, key, with(header(), "alg", "HS256"), payload()), TokenErrInvalidAlgorithm, "alg", "HS256"},
+		{"audience", signTestToken(t, key, header(), with(payload(), "aud", "other")), TokenErrInvalidAudience, "aud", "other"},
+		{"issuer", signTestToken(t, key, header(), with(payload(), "iss", "other")), TokenErrInvalidIssuer, "iss", "other"},
+		{"subject", signTestToken(t, key, header(), with(payload(), "sub", nil)), TokenErrInvalidSubject, "sub", ""},
+		{"future", signTestToken(t, key, header(), with(payload(), "iat", now.Unix()+1000)), TokenErrIssuedInFuture, "iat", now.Unix() + 1000},
+		{"expired", signTestToken(t, key, header(), with(payload(), "exp", now.Unix()-1000)), TokenErrIDTokenExpired, "exp", now.Unix() - 1000},
+		{"signature", signTestToken(t, otherKey, header(), payload()), TokenErrInvalidSignature, "kid", "kid1"},
+	}
+	for _, tc := range cases {
+		_, err := tv.VerifyToken(context.Background(), tc.token)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: VerifyToken() = %v; want = %s", tc.name, err, tc.want.Code)
+			continue
+		}
+		var te *TokenError
+		if !errors.As(err, &te) {
+			t.Errorf("%s: VerifyToken() = %T; want = *TokenError", tc.name, err)
+		} else if te.Claim != tc.claim || (tc.value != nil && te.Value != tc.value) {
+			t.Errorf("%s: TokenError = (%q, %v); want = (%q, %v)", tc.name, te.Claim, te.Value, tc.claim, tc.value)
+		}
+	}
+
+	fetchErr := errors.New("fetch failed")
+	tv.keySource = &mockKeySource{err: fetchErr}
+	_, err = tv.VerifyToken(context.Background(), valid)
+	if !errors.Is(err, TokenErrCertificateFetchFailed) || !errors.Is(err, fetchErr) {
+		t.Errorf("VerifyToken() = %v; want = %s wrapping %v", err, TokenErrCertificateFetchFailed.Code, fetchErr)
+	}
+
+	tv.projectID = ""
+	if _, err := tv.VerifyToken(context.Background(), valid); !errors.Is(err, TokenErrProjectIDMissing) {
+		t.Errorf("VerifyToken() = %v; want = %s", err, TokenErrProjectIDMissing.Code)
+	}
+}
+
+func TestSessionCookieExpiredError(t *testing.T) {
+	tv, err := newSessionCookieVerifier(context.Background(), testProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{Expires: 1, IssuedAt: 1}
+	if err := tv.verifyTimestamps(token); !errors.Is(err, TokenErrSessionCookieExpired) {
+		t.Errorf("verifyTimestamps() = %v; want = %s", err, TokenErrSessionCookieExpired.Code)
+	}
+	if err := tv.revokedTokenError(token); !errors.Is(err, TokenErrSessionCookieRevoked) {
+		t.Errorf("revokedTokenError() = %v; want = %s", err, TokenErrSessionCookieRevoked.Code)
+	}
+}
+
+// keyServer serves the test certificates, or fails if err is set.
+type keyServer struct {
+	mu       sync.Mutex
+	certs    []byte
+	maxAge   int
+	err      error
+	requests int
+	block    chan struct{}
+}
+
+func (s *keyServer) RoundTrip(*http.Request) (*http.Response, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": {fmt.Sprintf("max-age=%d", s.maxAge)}},
+		Body:       ioutil.NopCloser(bytes.NewReader(s.certs)),
+	}, nil
+}
+
+func (s *keyServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func newKeyServer(t *testing.T, maxAge int) *keyServer {
+	data, err := ioutil.ReadFile("testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &keyServer{certs: data, maxAge: maxAge}
+}
+
+func TestHTTPKeySourceServesStaleKeys(t *testing.T) {
+	server := newKeyServer(t, 100)
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+	mc := &MockClock{Timestamp: time.Unix(0, 0)}
+	ks.Clock = mc
+	if _, err := ks.Keys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	server.err = errors.New("transport error")
+	server.mu.Unlock()
+	mc.Timestamp = time.Unix(101, 0)
+	for i := 0; i < 3; i++ {
+		keys, err := ks.Keys(context.Background())
+		if len(keys) != 3 || err != nil {
+			t.Fatalf("Keys() = (%d, %v); want = (3, nil)", len(keys), err)
+		}
+	}
+	if got := server.count(); got != 2 {
+		t.Errorf("HTTP calls: %d; want: 2", got)
+	}
+
+	mc.Timestamp = mc.Timestamp.Add(keyFetchMinBackoff + time.Second)
+	if _, err := ks.Keys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.count(); got != 3 {
+		t.Errorf("HTTP calls: %d; want: 3", got)
+	}
+}
+
+func TestHTTPKeySourceBackoff(t *testing.T) {
+	server := newKeyServer(t, 100)
+	server.err = errors.New("transport error")
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+	mc := &MockClock{Timestamp: time.Unix(0, 0)}
+	ks.Clock = mc
+	for i := 0; i < 3; i++ {
+		if keys, err := ks.Keys(context.Background()); keys != nil || err == nil {
+			t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
+		}
+	}
+	if got := server.count(); got != 1 {
+		t.Errorf("HTTP calls: %d; want: 1", got)
+	}
+
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, keyFetchMaxBackoff},
+	}
+	for _, tc := range cases {
+		if got := keyFetchBackoff(tc.failures); got != tc.want {
+			t.Errorf("keyFetchBackoff(%d) = %v; want = %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestHTTPKeySourceCollapsesFetches(t *testing.T) {
+	server := newKeyServer(t, 100)
+	server.block = make(chan struct{})
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if keys, err := ks.Keys(context.Background()); len(keys) != 3 || err != nil {
+				t.Errorf("Keys() = (%d, %v); want = (3, nil)", len(keys), err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(server.block)
+	wg.Wait()
+	if got := server.count(); got != 1 {
+		t.Errorf("HTTP calls: %d; want: 1", got)
+	}
+}
+
+func TestHTTPKeySourceCallerCancels(t *testing.T) {
+	server := newKeyServer(t, 100)
+	server.block = make(chan struct{})
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := ks.Keys(ctx)
+		canceled <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Errorf("Keys() = %v; want = %v", err, context.Canceled)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if keys, err := ks.Keys(context.Background()); len(keys) != 3 || err != nil {
+			t.Errorf("Keys() = (%d, %v); want = (3, nil)", len(keys), err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(server.block)
+	<-done
+	if got := server.count(); got != 1 {
+		t.Errorf("HTTP calls: %d; want: 1", got)
+	}
+	if ks.err != nil || ks.failures != 0 {
+		t.Errorf("fetch failure = (%v, %d); want = (nil, 0)", ks.err, ks.failures)
+	}
+
+	ks = newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+	server.err = context.DeadlineExceeded
+	for i := 0; i < 2; i++ {
+		if _, err := ks.Keys(context.Background()); err == nil {
+			t.Errorf("Keys() = nil; want = error")
+		}
+	}
+	if got := server.count(); got != 3 {
+		t.Errorf("HTTP calls: %d; want: 3", got)
+	}
+	if ks.err != nil || ks.failures != 0 {
+		t.Errorf("fetch failure = (%v, %d); want = (nil, 0)", ks.err, ks.failures)
+	}
+}
+
+func TestHTTPKeySourceRefresher(t *testing.T) {
+	server := newKeyServer(t, 0)
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+	ks.startRefresher()
+	if _, err := ks.Keys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := server.count(); got < 2 {
+		t.Fatalf("HTTP calls: %d; want: >= 2", got)
+	}
+
+	ks.Close()
+	count := server.count()
+	time.Sleep(keyFetchMinBackoff + 100*time.Millisecond)
+	if got := server.count(); got > count+1 {
+		t.Errorf("HTTP calls after Close: %d; want: <= %d", got, count+1)
+	}
+}
+
+func TestHTTPKeySourceRefresherCallerClient(t *testing.T) {
+	server := newKeyServer(t, 0)
+	caller := newKeyServer(t, 0)
+	ks := newHTTPKeySource("http://mock.url", &http.Client{Transport: server})
+	ks.startRefresher()
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: caller})
+	if _, err := ks.Keys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(keyFetchMinBackoff + 100*time.Millisecond)
+	if got := server.count(); got != 0 {
+		t.Errorf("HTTP calls with the key source client: %d; want: 0", got)
+	}
+	if got := caller.count(); got != 1 {
+		t.Errorf("HTTP calls with the caller client: %d; want: 1", got)
+	}
+	ks.Mutex.RLock()
+	defer ks.Mutex.RUnlock()
+	if ks.started {
+		t.Errorf("refresher started after a fetch with the caller client")
+	}
+}
+
 func TestFindMaxAge(t *testing.T) {
 	cases := []struct {
 		cc   string
@@ -0,0 +1,267 @@
+package firebase
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// UserToImport defines the data model of a user migrated with ImportUsers.
+// Only UID is required.
+type UserToImport struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	DisplayName   string
+	PhotoURL      string
+	PhoneNumber   string
+	Disabled      bool
+	// PasswordHash is the hash of the user's password, computed with the
+	// algorithm given in UserImportOptions.Hash.
+	PasswordHash []byte
+	// PasswordSalt is the salt used to hash the user's password, if any.
+	PasswordSalt []byte
+	// CustomClaims are the custom claims of the user, available in its ID
+	// tokens.
+	CustomClaims map[string]interface{}
+	// ProviderData are the identity providers linked to the user.  Their
+	// UID and ProviderID are required.
+	ProviderData []*UserInfo
+	// Metadata holds the creation and last sign in times of the user.
+	Metadata *UserMetadata
+}
+
+// UserImportOptions are the options of ImportUsers.
+type UserImportOptions struct {
+	// Hash is the algorithm the password hashes of the users were computed
+	// with.  It is required when any user has a PasswordHash.
+	Hash UserImportHash
+}
+
+// UserImportResult is the result of ImportUsers.
+type UserImportResult struct {
+	// SuccessCount is the number of users imported.
+	SuccessCount int
+	// FailureCount is the number of users that could not be imported.
+	FailureCount int
+	// Errors describe the users that could not be imported.
+	Errors []*UserImportErrorInfo
+}
+
+// UserImportErrorInfo describes a user that could not be imported.
+type UserImportErrorInfo struct {
+	// Index is the index of the user in the users given to ImportUsers.
+	Index int
+	// Reason is the error message returned by the server.
+	Reason string
+}
+
+// UserImportHash is a password hash algorithm supported by ImportUsers.  It is
+// one of HashScrypt, HashStandardScrypt, HashBcrypt, HashHMACSHA256,
+// HashHMACSHA512, HashPBKDF2SHA256, HashSHA1, HashSHA256, HashSHA512 or
+// HashMD5.
+type UserImportHash interface {
+	// config returns the parameters of the algorithm for uploadAccount.
+	config() (*hashConfig, error)
+}
+
+// hashConfig holds the hash parameters of an uploadAccount request.
+type hashConfig struct {
+	HashAlgorithm   string `json:"hashAlgorithm"`
+	SignerKey       string `json:"signerKey,omitempty"`
+	SaltSeparator   string `json:"saltSeparator,omitempty"`
+	Rounds          int    `json:"rounds,omitempty"`
+	MemoryCost      int    `json:"memoryCost,omitempty"`
+	CPUMemCost      int    `json:"cpuMemCost,omitempty"`
+	Parallelization int    `json:"parallelization,omitempty"`
+	BlockSize       int    `json:"blockSize,omitempty"`
+	DerivedKeyLen   int    `json:"dkLen,omitempty"`
+}
+
+// invalidHashError returns the error of an invalid parameter of a hash
+// algorithm.
+func invalidHashError(format string, args ...interface{}) error {
+	return &APIError{
+		Code:    AuthErrInvalidHashAlgorithm.Code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// checkRounds validates the number of rounds of a hash algorithm.
+func checkRounds(algorithm string, rounds, min, max int) error {
+	if rounds < min || rounds > max {
+		return invalidHashError("%s rounds must be between %d and %d", algorithm, min, max)
+	}
+	return nil
+}
+
+// HashScrypt is the modified scrypt algorithm used by Firebase Auth.  Its
+// parameters are shown in the password hash parameters of the Firebase console.
+type HashScrypt struct {
+	// Key is the signer key.
+	Key []byte
+	// SaltSeparator is the salt separator.
+	SaltSeparator []byte
+	// Rounds is the number of rounds, between 1 and 8.
+	Rounds int
+	// MemoryCost is the memory cost, between 1 and 14.
+	MemoryCost int
+}
+
+func (h HashScrypt) config() (*hashConfig, error) {
+	if len(h.Key) == 0 {
+		return nil, invalidHashError("SCRYPT requires a signer key")
+	}
+	if err := checkRounds("SCRYPT", h.Rounds, 1, 8); err != nil {
+		return nil, err
+	}
+	if h.MemoryCost < 1 || h.MemoryCost > 14 {
+		return nil, invalidHashError("SCRYPT memory cost must be between 1 and 14")
+	}
+	return &hashConfig{
+		HashAlgorithm: "SCRYPT",
+		SignerKey:     base64.RawURLEncoding.EncodeToString(h.Key),
+		SaltSeparator: base64.RawURLEncoding.EncodeToString(h.SaltSeparator),
+		Rounds:        h.Rounds,
+		MemoryCost:    h.MemoryCost,
+	}, nil
+}
+
+// HashStandardScrypt is the standard scrypt algorithm.
+type HashStandardScrypt struct {
+	// BlockSize is the block size, which must be positive.
+	BlockSize int
+	// DerivedKeyLength is the length of the derived key, which must be positive.
+	DerivedKeyLength int
+	// MemoryCost is the CPU/memory cost, which must be positive.
+	MemoryCost int
+	// Parallelization is the parallelization factor, which must be positive.
+	Parallelization int
+}
+
+func (h HashStandardScrypt) config() (*hashConfig, error) {
+	if h.BlockSize <= 0 {
+		return nil, invalidHashError("STANDARD_SCRYPT block size must be positive")
+	}
+	if h.DerivedKeyLength <= 0 {
+		return nil, invalidHashError("STANDARD_SCRYPT derived key length must be positive")
+	}
+	if h.MemoryCost <= 0 {
+		return nil, invalidHashError("STANDARD_SCRYPT memory cost must be positive")
+	}
+	if h.Parallelization <= 0 {
+		return nil, invalidHashError("STANDARD_SCRYPT parallelization must be positive")
+	}
+	return &hashConfig{
+		HashAlgorithm:   "STANDARD_SCRYPT",
+		BlockSize:       h.BlockSize,
+		DerivedKeyLen:   h.DerivedKeyLength,
+		CPUMemCost:      h.MemoryCost,
+		Parallelization: h.Parallelization,
+	}, nil
+}
+
+// HashBcrypt is the bcrypt algorithm.
+type HashBcrypt struct{}
+
+func (h HashBcrypt) config() (*hashConfig, error) {
+	return &hashConfig{HashAlgorithm: "BCRYPT"}, nil
+}
+
+// HashHMACSHA256 is the HMAC-SHA256 algorithm.
+type HashHMACSHA256 struct {
+	// Key is the HMAC key.
+	Key []byte
+}
+
+func (h HashHMACSHA256) config() (*hashConfig, error) {
+	return hmacConfig("HMAC_SHA256", h.Key)
+}
+
+// HashHMACSHA512 is the HMAC-SHA512 algorithm.
+type HashHMACSHA512 struct {
+	// Key is the HMAC key.
+	Key []byte
+}
+
+func (h HashHMACSHA512) config() (*hashConfig, error) {
+	return hmacConfig("HMAC_SHA512", h.Key)
+}
+
+func hmacConfig(algorithm string, key []byte) (*hashConfig, error) {
+	if len(key) == 0 {
+		return nil, invalidHashError("%s requires a signer key", algorithm)
+	}
+	return &hashConfig{
+		HashAlgorithm: algorithm,
+		SignerKey:     base64.RawURLEncoding.EncodeToString(key),
+	}, nil
+}
+
+// HashPBKDF2SHA256 is the PBKDF2 algorithm with SHA256.
+type HashPBKDF2SHA256 struct {
+	// Rounds is the number of rounds, between 0 and 120000.
+	Rounds int
+}
+
+func (h HashPBKDF2SHA256) config() (*hashConfig, error) {
+	return roundsConfig("PBKDF2_SHA256", h.Rounds, 0, 120000)
+}
+
+// HashSHA1 is the SHA1 algorithm.
+type HashSHA1 struct {
+	// Rounds is the number of rounds, between 1 and 8192.
+	Rounds int
+}
+
+func (h HashSHA1) config() (*hashConfig, error) {
+	return roundsConfig("SHA1", h.Rounds, 1, 8192)
+}
+
+// HashSHA256 is the SHA256 algorithm.
+type HashSHA256 struct {
+	// Rounds is the number of rounds, between 1 and 8192.
+	Rounds int
+}
+
+func (h HashSHA256) config() (*hashConfig, error) {
+	return roundsConfig("SHA256", h.Rounds, 1, 8192)
+}
+
+// HashSHA512 is the SHA512 algorithm.
+type HashSHA512 struct {
+	// Rounds is the number of rounds, between 1 and 8192.
+	Rounds int
+}
+
+func (h HashSHA512) config() (*hashConfig, error) {
+	return roundsConfig("SHA512", h.Rounds, 1, 8192)
+}
+
+// HashMD5 is the MD5 algorithm.
+type HashMD5 struct {
+	// Rounds is the number of rounds, between 0 and 8192.
+	Rounds int
+}
+
+func (h HashMD5) config() (*hashConfig, error) {
+	return roundsConfig("MD5", h.Rounds, 0, 8192)
+}
+
+func roundsConfig(algorithm string, rounds, min, max int) (*hashConfig, error) {
+	if err := checkRounds(algorithm, rounds, min, max); err != nil {
+		return nil, err
+	}
+	return &hashConfig{
+		HashAlgorithm: algorithm,
+		Rounds:        rounds,
+	}, nil
+}
+
+// millis returns t in milliseconds since epoch, or zero for the zero time.
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,151 @@
+package firebase
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportUsers(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/uploadAccount"))
+		w.Write([]byte(`{"error":[{"index":1,"message":"DUPLICATE_EMAIL"}]}`))
+	}))
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	users := []*UserToImport{
+		{
+			UID:           "user1",
+			Email:         "user1@example.com",
+			EmailVerified: true,
+			PhoneNumber:   "+15555550100",
+			PasswordHash:  []byte("password-hash"),
+			PasswordSalt:  []byte("salt"),
+			CustomClaims:  map[string]interface{}{"admin": true},
+			ProviderData: []*UserInfo{{
+				UID:        "google-uid",
+				ProviderID: "google.com",
+				Email:      "user1@gmail.com",
+			}},
+			Metadata: &UserMetadata{CreatedAt: time.Unix(1500000000, 0)},
+		},
+		{UID: "user2", Email: "user1@example.com"},
+	}
+	result, err := auth.ImportUsers(users, &UserImportOptions{
+		Hash: HashScrypt{Key: []byte("key"), SaltSeparator: []byte("sep"), Rounds: 8, MemoryCost: 14},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.SuccessCount)
+	assert.Equal(t, 1, result.FailureCount)
+	assert.Equal(t, []*UserImportErrorInfo{{Index: 1, Reason: "DUPLICATE_EMAIL"}}, result.Errors)
+
+	assert.Equal(t, "SCRYPT", body["hashAlgorithm"])
+	assert.Equal(t, "a2V5", body["signerKey"])
+	assert.Equal(t, "c2Vw", body["saltSeparator"])
+	assert.Equal(t, float64(8), body["rounds"])
+	assert.Equal(t, float64(14), body["memoryCost"])
+	user := body["users"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"localId":          "user1",
+		"email":            "user1@example.com",
+		"emailVerified":    true,
+		"phoneNumber":      "+15555550100",
+		"passwordHash":     "cGFzc3dvcmQtaGFzaA",
+		"salt":             "c2FsdA",
+		"customAttributes": `{"admin":true}`,
+		"providerUserInfo": []interface{}{map[string]interface{}{
+			"rawId":      "google-uid",
+			"providerId": "google.com",
+			"email":      "user1@gmail.com",
+		}},
+		"createdAt": float64(1500000000000),
+	}, user)
+}
+
+func TestImportUsersHashes(t *testing.T) {
+	cases := []struct {
+		hash UserImportHash
+		want hashConfig
+	}{
+		{HashStandardScrypt{BlockSize: 8, DerivedKeyLength: 64, MemoryCost: 1024, Parallelization: 16},
+			hashConfig{HashAlgorithm: "STANDARD_SCRYPT", BlockSize: 8, DerivedKeyLen: 64, CPUMemCost: 1024, Parallelization: 16}},
+		{HashBcrypt{}, hashConfig{HashAlgorithm: "BCRYPT"}},
+		{HashHMACSHA256{Key: []byte("key")}, hashConfig{HashAlgorithm: "HMAC_SHA256", SignerKey: "a2V5"}},
+		{HashHMACSHA512{Key: []byte("key")}, hashConfig{HashAlgorithm: "HMAC_SHA512", SignerKey: "a2V5"}},
+		{HashPBKDF2SHA256{Rounds: 100000}, hashConfig{HashAlgorithm: "PBKDF2_SHA256", Rounds: 100000}},
+		{HashSHA1{Rounds: 1}, hashConfig{HashAlgorithm: "SHA1", Rounds: 1}},
+		{HashSHA256{Rounds: 8192}, hashConfig{HashAlgorithm: "SHA256", Rounds: 8192}},
+		{HashSHA512{Rounds: 10}, hashConfig{HashAlgorithm: "SHA512", Rounds: 10}},
+		{HashMD5{}, hashConfig{HashAlgorithm: "MD5"}},
+	}
+	for _, tc := range cases {
+		config, err := tc.hash.config()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, *config)
+	}
+
+	invalid := []UserImportHash{
+		HashScrypt{Rounds: 8, MemoryCost: 14},
+		HashScrypt{Key: []byte("key"), Rounds: 9, MemoryCost: 14},
+		HashScrypt{Key: []byte("key"), Rounds: 8, MemoryCost: 15},
+		HashStandardScrypt{DerivedKeyLength: 64, MemoryCost: 1024, Parallelization: 16},
+		HashStandardScrypt{BlockSize: 8, MemoryCost: 1024, Parallelization: 16},
+		HashStandardScrypt{BlockSize: 8, DerivedKeyLength: 64, MemoryCost: -1, Parallelization: 16},
+		HashStandardScrypt{BlockSize: 8, DerivedKeyLength: 64, MemoryCost: 1024},
+		HashHMACSHA256{},
+		HashHMACSHA512{},
+		HashPBKDF2SHA256{Rounds: 120001},
+		HashSHA1{},
+		HashSHA256{Rounds: 8193},
+		HashMD5{Rounds: -1},
+	}
+	for _, h := range invalid {
+		_, err := h.config()
+		assert.True(t, errors.Is(err, AuthErrInvalidHashAlgorithm), "%#v", h)
+	}
+}
+
+func TestImportUsersValidation(t *testing.T) {
+	auth := newEmulatedAuth("localhost:0")
+	hash := &UserImportOptions{Hash: HashBcrypt{}}
+	cases := []struct {
+		user *UserToImport
+		opts *UserImportOptions
+		want error
+	}{
+		{&UserToImport{}, nil, AuthErrInvalidUID},
+		{&UserToImport{UID: "u", Email: "invalid"}, nil, AuthErrInvalidEmail},
+		{&UserToImport{UID: "u", PhoneNumber: "555"}, nil, AuthErrInvalidPhoneNumber},
+		{&UserToImport{UID: "u", PhotoURL: "not a url"}, nil, AuthErrInvalidPhotoURL},
+		{&UserToImport{UID: "u", CustomClaims: map[string]interface{}{"sub": "x"}}, nil, AuthErrForbiddenClaim},
+		{&UserToImport{UID: "u", CustomClaims: map[string]interface{}{"k": strings.Repeat("x", 1000)}}, nil, AuthErrClaimsTooLarge},
+		{&UserToImport{UID: "u", ProviderData: []*UserInfo{{UID: "p"}}}, nil, AuthErrInvalidProviderID},
+		{&UserToImport{UID: "u", ProviderData: []*UserInfo{{ProviderID: "google.com"}}}, nil, AuthErrInvalidProviderUID},
+		{&UserToImport{UID: "u", PasswordHash: []byte("h")}, nil, AuthErrInvalidHashAlgorithm},
+		{&UserToImport{UID: "u", PasswordHash: []byte("h")}, &UserImportOptions{Hash: HashSHA1{}}, AuthErrInvalidHashAlgorithm},
+		{nil, hash, errNullUserProperty},
+	}
+	for _, tc := range cases {
+		_, err := auth.ImportUsers([]*UserToImport{tc.user}, tc.opts)
+		assert.True(t, errors.Is(err, tc.want), "%v: got %v, want %v", tc.user, err, tc.want)
+	}
+
+	users := make([]*UserToImport, 1001)
+	_, err := auth.ImportUsers(users, hash)
+	assert.Equal(t, AuthErrMaximumUserCountExceeded, err)
+
+	result, err := auth.ImportUsers(nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.SuccessCount)
+}
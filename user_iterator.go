@@ -0,0 +1,56 @@
+package firebase
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
+
+// UserPage is a page of users returned by ListUsers.
+type UserPage struct {
+	// Users are the users of the page.
+	Users []*UserRecord
+	// NextPageToken is the token of the next page, or empty on the last page.
+	NextPageToken string
+}
+
+// UserIterator iterates over all the users of the project, fetching them page
+// by page with ListUsers.
+type UserIterator struct {
+	// PageSize is the number of users fetched per request, at most 1000.  Zero
+	// means 1000.  It must be set before the first call to Next.
+	PageSize int
+
+	auth      *Auth
+	ctx       context.Context
+	users     []*UserRecord
+	pageToken string
+	done      bool
+	err       error
+}
+
+// Next returns the next user.  It returns iterator.Done once all the users
+// have been returned, and the error of the context once it is done.
+func (it *UserIterator) Next() (*UserRecord, error) {
+	if err := it.ctx.Err(); err != nil {
+		return nil, err
+	}
+	for len(it.users) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		if it.done {
+			return nil, iterator.Done
+		}
+		page, err := it.auth.ListUsersWithContext(it.ctx, it.pageToken, it.PageSize)
+		if err != nil {
+			it.err = err
+			return nil, err
+		}
+		it.users = page.Users
+		it.pageToken = page.NextPageToken
+		it.done = page.NextPageToken == ""
+	}
+	user := it.users[0]
+	it.users = it.users[1:]
+	return user, nil
+}
@@ -0,0 +1,102 @@
+package firebase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+)
+
+// newDownloadAccountServer returns a server listing the given number of users
+// in pages of the requested size, recording the requests.
+func newDownloadAccountServer(total int, requests *[]downloadAccountRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req downloadAccountRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		*requests = append(*requests, req)
+
+		start := 0
+		fmt.Sscanf(req.NextPageToken, "page-%d", &start)
+		resp := downloadAccountResponse{}
+		for i := start; i < total && i < start+req.MaxResults; i++ {
+			resp.Users = append(resp.Users, &accountInfo{LocalID: fmt.Sprintf("user%d", i)})
+		}
+		if start+req.MaxResults < total {
+			resp.NextPageToken = fmt.Sprintf("page-%d", start+req.MaxResults)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestListUsers(t *testing.T) {
+	var requests []downloadAccountRequest
+	server := newDownloadAccountServer(3, &requests)
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	page, err := auth.ListUsers("", 2)
+	assert.NoError(t, err)
+	assert.Len(t, page.Users, 2)
+	assert.Equal(t, "user0", page.Users[0].UID)
+	assert.Equal(t, "page-2", page.NextPageToken)
+
+	page, err = auth.ListUsers(page.NextPageToken, 0)
+	assert.NoError(t, err)
+	assert.Len(t, page.Users, 1)
+	assert.Equal(t, "user2", page.Users[0].UID)
+	assert.Empty(t, page.NextPageToken)
+	assert.Equal(t, []downloadAccountRequest{
+		{MaxResults: 2},
+		{MaxResults: 1000, NextPageToken: "page-2"},
+	}, requests)
+
+	_, err = auth.ListUsers("", 1001)
+	assert.Equal(t, errInvalidPageSize, err)
+}
+
+func TestUserIterator(t *testing.T) {
+	var requests []downloadAccountRequest
+	server := newDownloadAccountServer(5, &requests)
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	it := auth.Users(context.Background())
+	it.PageSize = 2
+	var uids []string
+	for {
+		user, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		assert.NoError(t, err)
+		uids = append(uids, user.UID)
+	}
+	assert.Equal(t, []string{"user0", "user1", "user2", "user3", "user4"}, uids)
+	assert.Len(t, requests, 3)
+
+	_, err := it.Next()
+	assert.Equal(t, iterator.Done, err)
+}
+
+func TestUserIteratorCancelled(t *testing.T) {
+	var requests []downloadAccountRequest
+	server := newDownloadAccountServer(5, &requests)
+	defer server.Close()
+	auth := newEmulatedAuth(strings.TrimPrefix(server.URL, "http://"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it := auth.Users(ctx)
+	it.PageSize = 2
+	_, err := it.Next()
+	assert.NoError(t, err)
+	cancel()
+	_, err = it.Next()
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, requests, 1)
+}